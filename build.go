@@ -66,6 +66,7 @@ func (b *Build) UnmarshalYAML(value *yaml.Node) error {
 			return err
 		}
 		b.Context = vString
+		return nil
 	}
 	return fmt.Errorf("unsupported node tag type for %T: %q", b, value.Tag)
 }
@@ -0,0 +1,196 @@
+package squadron
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// secretStoreSaltSize is the size of the random salt prefixing the secret cache file
+	secretStoreSaltSize = 16
+	// scrypt parameters as recommended for interactive use
+	secretStoreScryptN = 1 << 15
+	secretStoreScryptR = 8
+	secretStoreScryptP = 1
+	secretStoreKeySize = 32
+)
+
+// cache holds the results of template function calls for a single run so that
+// repeated references and multiple render passes only execute them once
+type cache struct {
+	values  map[string]interface{}
+	secrets map[string]bool
+	store   *secretStore
+}
+
+func newCache() *cache {
+	return &cache{
+		values:  map[string]interface{}{},
+		secrets: map[string]bool{},
+	}
+}
+
+// get returns the cached value for key or calls fetch once to retrieve it
+func (c *cache) get(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if value, ok := c.values[key]; ok {
+		return value, nil
+	}
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.values[key] = value
+	return value, nil
+}
+
+// secret works like get but also consults the optional on-disk store and
+// records the secret name for the fetch summary
+func (c *cache) secret(name string, fetch func() (string, error)) (string, error) {
+	key := "secret:" + name
+	if value, ok := c.values[key].(string); ok {
+		return value, nil
+	}
+	if c.store != nil {
+		if value, ok := c.store.get(name); ok {
+			c.values[key] = value
+			return value, nil
+		}
+	}
+	value, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	c.values[key] = value
+	c.secrets[name] = true
+	if c.store != nil {
+		c.store.set(name, value)
+	}
+	return value, nil
+}
+
+// fetchedSecrets returns the sorted names of all secrets fetched in this run
+func (c *cache) fetchedSecrets() []string {
+	ret := make([]string, 0, len(c.secrets))
+	for name := range c.secrets {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+type secretStoreEntry struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// secretStore is an AES-GCM encrypted file holding secret values until their ttl expires,
+// the file consists of the scrypt salt, the nonce and the sealed entries
+type secretStore struct {
+	path       string
+	ttl        time.Duration
+	passphrase string
+	entries    map[string]secretStoreEntry
+}
+
+func newSecretStore(path string, ttl time.Duration, passphrase string) *secretStore {
+	return &secretStore{
+		path:       path,
+		ttl:        ttl,
+		passphrase: passphrase,
+		entries:    map[string]secretStoreEntry{},
+	}
+}
+
+func (s *secretStore) get(name string) (string, bool) {
+	entry, ok := s.entries[name]
+	if !ok || time.Now().After(entry.Expires) {
+		return "", false
+	}
+	return entry.Value, true
+}
+
+func (s *secretStore) set(name, value string) {
+	s.entries[name] = secretStoreEntry{Value: value, Expires: time.Now().Add(s.ttl)}
+}
+
+func (s *secretStore) load() error {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read secret cache")
+	}
+	if len(data) < secretStoreSaltSize {
+		return errors.New("invalid secret cache file")
+	}
+	salt, data := data[:secretStoreSaltSize], data[secretStoreSaltSize:]
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+	if len(data) < gcm.NonceSize() {
+		return errors.New("invalid secret cache file")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt secret cache")
+	}
+	entries := map[string]secretStoreEntry{}
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return errors.Wrap(err, "failed to unmarshal secret cache")
+	}
+	now := time.Now()
+	for name, entry := range entries {
+		if now.Before(entry.Expires) {
+			s.entries[name] = entry
+		}
+	}
+	return nil
+}
+
+func (s *secretStore) save() error {
+	plain, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, secretStoreSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0744); err != nil {
+		return errors.Wrap(err, "failed to create secret cache directory")
+	}
+	return ioutil.WriteFile(s.path, gcm.Seal(append(salt, nonce...), nonce, plain, nil), 0600)
+}
+
+// cipher derives the key from the passphrase and salt
+func (s *secretStore) cipher(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(s.passphrase), salt, secretStoreScryptN, secretStoreScryptR, secretStoreScryptP, secretStoreKeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive secret cache key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -3,7 +3,11 @@ package squadron
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
 
 	"gopkg.in/yaml.v3"
 
@@ -15,6 +19,7 @@ type ChartDependency struct {
 	Repository string `yaml:"repository,omitempty"`
 	Version    string `yaml:"version,omitempty"`
 	Alias      string `yaml:"alias,omitempty"`
+	Condition  string `yaml:"condition,omitempty"`
 }
 
 func (cd *ChartDependency) UnmarshalYAML(value *yaml.Node) error {
@@ -44,9 +49,41 @@ type Chart struct {
 	Description  string            `yaml:"description,omitempty"`
 	Type         string            `yaml:"type,omitempty"`
 	Version      string            `yaml:"version,omitempty"`
+	AppVersion   string            `yaml:"appVersion,omitempty"`
+	KubeVersion  string            `yaml:"kubeVersion,omitempty"`
+	Keywords     []string          `yaml:"keywords,omitempty"`
+	Home         string            `yaml:"home,omitempty"`
+	Sources      []string          `yaml:"sources,omitempty"`
+	Icon         string            `yaml:"icon,omitempty"`
+	Maintainers  []ChartMaintainer `yaml:"maintainers,omitempty"`
+	Annotations  map[string]string `yaml:"annotations,omitempty"`
 	Dependencies []ChartDependency `yaml:"dependencies,omitempty"`
 }
 
+type ChartMaintainer struct {
+	Name  string `yaml:"name,omitempty"`
+	Email string `yaml:"email,omitempty"`
+	URL   string `yaml:"url,omitempty"`
+}
+
+// ChartMetadata configures the generated umbrella chart
+type ChartMetadata struct {
+	Description string            `yaml:"description,omitempty"`
+	Version     string            `yaml:"version,omitempty"`
+	AppVersion  string            `yaml:"appVersion,omitempty"`
+	KubeVersion string            `yaml:"kubeVersion,omitempty"`
+	Keywords    []string          `yaml:"keywords,omitempty"`
+	Home        string            `yaml:"home,omitempty"`
+	Sources     []string          `yaml:"sources,omitempty"`
+	Icon        string            `yaml:"icon,omitempty"`
+	Maintainers []ChartMaintainer `yaml:"maintainers,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	// Templates are files or glob patterns copied into the chart's templates directory
+	Templates []string `yaml:"templates,omitempty"`
+	// Repository is the OCI registry or ChartMuseum compatible repository the chart is published to
+	Repository string `yaml:"repository,omitempty"`
+}
+
 func newChart(name, version string) *Chart {
 	return &Chart{
 		APIVersion:  chartAPIVersionV2,
@@ -57,8 +94,24 @@ func newChart(name, version string) *Chart {
 	}
 }
 
+// applyMetadata overrides the defaults with the configured metadata, the version is resolved by the caller
+func (c *Chart) applyMetadata(m ChartMetadata) {
+	if m.Description != "" {
+		c.Description = m.Description
+	}
+	c.AppVersion = m.AppVersion
+	c.KubeVersion = m.KubeVersion
+	c.Keywords = m.Keywords
+	c.Home = m.Home
+	c.Sources = m.Sources
+	c.Icon = m.Icon
+	c.Maintainers = m.Maintainers
+	c.Annotations = m.Annotations
+}
+
 func (c *Chart) addDependency(alias string, cd ChartDependency) {
 	cd.Alias = alias
+	cd.Condition = alias + ".enabled"
 	c.Dependencies = append(c.Dependencies, cd)
 }
 
@@ -85,3 +138,43 @@ func (c Chart) generate(chartPath string, overrides interface{}) error {
 	}
 	return nil
 }
+
+// copyTemplates copies the files matching the patterns into the chart's templates directory
+func copyTemplates(chartPath string, patterns []string) error {
+	var files []string
+	// the templates are flattened into the templates dir
+	names := map[string]string{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid template pattern %q", pattern)
+		} else if len(matches) == 0 {
+			return errors.Errorf("no chart templates found for %q", pattern)
+		}
+		for _, file := range matches {
+			if existing, ok := names[filepath.Base(file)]; ok && existing != file {
+				return errors.Errorf("chart templates %q and %q share the same name", existing, file)
+			} else if !ok {
+				names[filepath.Base(file)] = file
+				files = append(files, file)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	dir := path.Join(chartPath, chartTemplatesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read chart template %q", file)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, filepath.Base(file)), data, 0644); err != nil { //nolint:gosec
+			return err
+		}
+	}
+	return nil
+}
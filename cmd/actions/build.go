@@ -2,11 +2,10 @@ package actions
 
 import (
 	"github.com/spf13/cobra"
-
-	"github.com/foomo/squadron"
 )
 
 func init() {
+	addSelectorFlags(buildCmd)
 	buildCmd.Flags().BoolVarP(&flagPush, "push", "p", false, "pushes built squadron units to the registry")
 }
 
@@ -16,12 +15,20 @@ var buildCmd = &cobra.Command{
 	Example: "  squadron build frontend backend",
 	Args:    cobra.MinimumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return build(args, cwd, flagFiles, flagPush)
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return build(args, cwd, files, flagPush, global)
+			})
+		}
+		return build(args, basePath, flagFiles, flagPush, nil)
 	},
 }
 
-func build(args []string, cwd string, files []string, push bool) error {
-	sq := squadron.New(cwd, "", files)
+func build(args []string, cwd string, files []string, push bool, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, "", files, global)
+	if err != nil {
+		return err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
 		return err
@@ -3,13 +3,15 @@ package actions
 import (
 	"fmt"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-
-	"github.com/foomo/squadron"
 )
 
 func init() {
+	addOverrideFlags(configCmd)
+	configCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "default", "specifies the namespace")
 	configCmd.Flags().BoolVar(&flagNoRender, "no-render", false, "don't render the config template")
+	configCmd.Flags().StringVarP(&flagOutput, "output", "o", "yaml", "specifies the output format (yaml, json, toml)")
 }
 
 var configCmd = &cobra.Command{
@@ -18,23 +20,52 @@ var configCmd = &cobra.Command{
 	Example: "  squadron config --file squadron.yaml --file squadron.override.yaml",
 	Args:    cobra.MinimumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return config(cwd, flagFiles, flagNoRender)
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return config(cwd, flagNamespace, files, flagNoRender, flagOutput, global)
+			})
+		}
+		return config(basePath, flagNamespace, flagFiles, flagNoRender, flagOutput, nil)
 	},
 }
 
-func config(cwd string, files []string, noRender bool) error {
-	sq := squadron.New(cwd, "", files)
+func config(cwd, namespace string, files []string, noRender bool, output string, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, namespace, files, global)
+	if err != nil {
+		return err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
 		return err
 	}
 
+	if err := sq.Override(flagSet, flagSetString, flagSetFile); err != nil {
+		return err
+	}
+
 	if !noRender {
 		if err := sq.RenderConfig(); err != nil {
 			return err
 		}
 	}
 
-	fmt.Println(sq.GetConfigYAML())
+	switch output {
+	case "yaml":
+		fmt.Println(sq.GetConfigYAML())
+	case "json":
+		out, err := sq.GetConfigJSON()
+		if err != nil {
+			return err
+		}
+		fmt.Println(out)
+	case "toml":
+		out, err := sq.GetConfigTOML()
+		if err != nil {
+			return err
+		}
+		fmt.Println(out)
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
 	return nil
 }
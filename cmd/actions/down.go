@@ -2,11 +2,11 @@ package actions
 
 import (
 	"github.com/spf13/cobra"
-
-	"github.com/foomo/squadron"
 )
 
 func init() {
+	downCmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "skip the confirmation of protected squadrons")
+	addSelectorFlags(downCmd)
 	downCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "default", "Specifies the namespace")
 }
 
@@ -16,22 +16,43 @@ var downCmd = &cobra.Command{
 	Example: "  squadron down frontend backend --namespace demo",
 	Args:    cobra.MinimumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return down(args, cwd, flagNamespace, flagFiles)
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return down(args, cwd, flagNamespace, files, global)
+			})
+		}
+		return down(args, basePath, flagNamespace, flagFiles, nil)
 	},
 }
 
-func down(args []string, cwd, namespace string, files []string) error {
-	sq := squadron.New(cwd, namespace, files)
+func down(args []string, cwd, namespace string, files []string, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, namespace, files, global)
+	if err != nil {
+		return err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
 		return err
 	}
 
+	// unit namespaces might be templates
+	if err := sq.RenderConfig(); err != nil {
+		return err
+	}
+
 	args, helmArgs := parseExtraArgs(args)
 	units, err := parseUnitArgs(args, sq.GetConfig().Units)
 	if err != nil {
 		return err
 	}
 
+	if err := guardKubeContext(sq, units); err != nil {
+		return err
+	}
+
+	if err := guardProtected(sq, units, "uninstall", true, flagYes); err != nil {
+		return err
+	}
+
 	return sq.Down(units, helmArgs)
 }
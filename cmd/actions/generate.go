@@ -1,31 +1,70 @@
 package actions
 
 import (
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+)
 
-	"github.com/foomo/squadron"
+var (
+	flagPackage     bool
+	flagDestination string
+	flagVersion     string
 )
 
+func init() {
+	addOverrideFlags(generateCmd)
+	generateCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "default", "specifies the namespace")
+	generateCmd.Flags().BoolVar(&flagPackage, "package", false, "package the umbrella chart into a versioned archive")
+	addPackageFlags(generateCmd)
+}
+
+// addPackageFlags helper
+func addPackageFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&flagDestination, "destination", "", "directory of the chart archive, defaults to the output directory")
+	cmd.Flags().StringVar(&flagVersion, "version", "", "chart version, defaults to chart.version or the latest git tag")
+}
+
 var generateCmd = &cobra.Command{
 	Use:     "generate",
 	Short:   "generate and view the squadron chart",
-	Example: "  squadron generate fronted backend",
+	Example: "  squadron generate --package --destination dist",
 	Args:    cobra.MinimumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return generate(cwd, flagFiles)
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return generate(cwd, flagNamespace, files, flagPackage, global)
+			})
+		}
+		return generate(basePath, flagNamespace, flagFiles, flagPackage, nil)
 	},
 }
 
-func generate(cwd string, files []string) error {
-	sq := squadron.New(cwd, "", files)
+func generate(cwd, namespace string, files []string, pkg bool, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, namespace, files, global)
+	if err != nil {
+		return err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
 		return err
 	}
 
+	if err := sq.Override(flagSet, flagSetString, flagSetFile); err != nil {
+		return err
+	}
+
 	if err := sq.RenderConfig(); err != nil {
 		return err
 	}
 
-	return sq.Generate(sq.GetConfig().Units)
+	if !pkg {
+		return sq.Generate(sq.GetConfig().Units)
+	}
+
+	file, err := sq.Package(flagDestination, flagVersion)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("packaged chart %q", file)
+	return nil
 }
@@ -0,0 +1,55 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/foomo/squadron"
+)
+
+// guardKubeContext refuses to continue on a kube context not allowed for the units' namespaces
+// unless the user confirms it interactively by typing the context name
+func guardKubeContext(sq *squadron.Squadron, units map[string]squadron.Unit) error {
+	err := sq.ValidateKubeContext(units)
+	contextErr, ok := errors.Cause(err).(*squadron.KubeContextError)
+	if !ok {
+		return err
+	}
+	if !isTerminal() {
+		return err
+	}
+	logrus.Warn(contextErr.Error())
+	if confirmed, err := newPrompter().confirmTyped("you are about to run against an unexpected kube context!", contextErr.Context); err != nil {
+		return err
+	} else if !confirmed {
+		return errors.New("aborted due to kube context mismatch")
+	}
+	return nil
+}
+
+// guardProtected requires the user to confirm actions on protected squadrons or namespaces by typing the squadron name
+func guardProtected(sq *squadron.Squadron, units map[string]squadron.Unit, action string, uninstall, yes bool) error {
+	if !sq.RequiresConfirmation(units, uninstall) {
+		return nil
+	}
+	releases := sq.Releases(units)
+	logrus.Warnf("%s affects the following releases of the protected squadron %s:", action, sq.Name())
+	for _, r := range releases {
+		logrus.Warnf("  %s/%s (%s)", r.Namespace, r.Name, strings.Join(r.Units, ", "))
+	}
+	if yes {
+		return nil
+	}
+	if !isTerminal() {
+		return errors.Errorf("%s of the protected squadron %s requires confirmation, use --yes to skip it", action, sq.Name())
+	}
+	if confirmed, err := newPrompter().confirmTyped(fmt.Sprintf("%s %d release(s)?", action, len(releases)), sq.Name()); err != nil {
+		return err
+	} else if !confirmed {
+		return errors.Errorf("aborted %s", action)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/foomo/squadron"
+	"github.com/foomo/squadron/util"
+)
+
+var (
+	flagInitName        string
+	flagInitRegistry    string
+	flagInitCreateChart bool
+	flagInitInteractive bool
+	flagInitForce       bool
+)
+
+func init() {
+	initCmd.Flags().StringVar(&flagInitName, "name", "", "name of the squadron, defaults to the directory name")
+	initCmd.Flags().StringVar(&flagInitRegistry, "registry", "", "registry prefix for the images of detected builds")
+	initCmd.Flags().BoolVar(&flagInitCreateChart, "create-chart", false, "generate a starter helm chart for units without chart")
+	initCmd.Flags().BoolVarP(&flagInitInteractive, "interactive", "i", false, "confirm detected units and settings interactively")
+	initCmd.Flags().BoolVar(&flagInitForce, "force", false, "overwrite an existing squadron.yaml")
+}
+
+var initCmd = &cobra.Command{
+	Use:     "init [DIR]",
+	Short:   "scaffold a squadron.yaml from the Dockerfiles and charts found in the directory tree",
+	Example: "  squadron init --name storefinder --registry docker.io/foomo --create-chart",
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		return initSquadron(dir, flagInitName, flagInitRegistry, flagInitCreateChart, flagInitInteractive, flagInitForce)
+	},
+}
+
+func initSquadron(dir, name, registry string, createChart, interactive, force bool) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "squadron.yaml")
+	if _, err := os.Stat(file); err == nil && !force {
+		return errors.Errorf("%q already exists, use --force to overwrite it", file)
+	}
+	units, err := squadron.DetectUnits(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to detect units")
+	}
+	if name == "" {
+		name = filepath.Base(dir)
+	}
+	if interactive {
+		p := newPrompter()
+		if name, err = p.ask("squadron name", name); err != nil {
+			return err
+		}
+		if registry, err = p.ask("image registry", registry); err != nil {
+			return err
+		}
+		var selected []squadron.ScaffoldUnit
+		for _, u := range units {
+			if ok, err := p.confirm(fmt.Sprintf("add unit %q (chart: %q, build: %q)", u.Name, u.Chart, u.Context), true); err != nil {
+				return err
+			} else if ok {
+				selected = append(selected, u)
+			}
+		}
+		units = selected
+		if !createChart {
+			for _, u := range units {
+				if u.Chart == "" {
+					if createChart, err = p.confirm("generate starter helm charts for units without chart", false); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+	}
+	for i, u := range units {
+		if u.Chart != "" {
+			continue
+		}
+		if !createChart {
+			logrus.Warnf("no chart found for unit %q, please add one", u.Name)
+			continue
+		}
+		chart := path.Join("charts", u.Name)
+		logrus.Infof("generating starter chart for unit %q in %q", u.Name, chart)
+		if out, err := util.NewHelmCommand().Create(filepath.Join(dir, filepath.FromSlash(chart))); err != nil {
+			return errors.Wrap(err, out)
+		}
+		units[i].Chart = "./" + chart
+	}
+	out, err := squadron.Scaffold(name, registry, units)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("writing %q with %d units", file, len(units))
+	if err := ioutil.WriteFile(file, out, 0644); err != nil { //nolint:gosec
+		return err
+	}
+	if added, err := squadron.AddGitignore(dir); err != nil {
+		return err
+	} else if added {
+		logrus.Info("added output directory to .gitignore")
+	}
+	return nil
+}
@@ -1,33 +1,170 @@
 package actions
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 
 	"github.com/foomo/squadron"
 )
 
+var flagListOutput string
+
+func init() {
+	addSelectorFlags(listCmd)
+	listCmd.Flags().BoolVar(&flagNoRender, "no-render", false, "don't render the config template")
+	listCmd.Flags().StringVarP(&flagListOutput, "output", "o", "table", "specifies the output format (table, json, yaml, names)")
+}
+
 var listCmd = &cobra.Command{
-	Use:     "list",
+	Use:     "list [UNIT...]",
 	Short:   "list squadron units",
-	Example: "  squadron list",
+	Example: "  squadron list 'frontend-*' '!legacy' --tag storefront --output json",
 	Args:    cobra.MinimumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return list(cwd, flagFiles)
+		var items []listItem
+		if flagWorkspace {
+			err := workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				squadronItems, err := list(args, cwd, files, flagNoRender, global)
+				for _, item := range squadronItems {
+					item.Squadron = name
+					items = append(items, item)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			return printList(items, flagListOutput)
+		}
+		items, err := list(args, basePath, flagFiles, flagNoRender, nil)
+		if err != nil {
+			return err
+		}
+		return printList(items, flagListOutput)
 	},
 }
 
-func list(cwd string, files []string) error {
-	sq := squadron.New(cwd, "", files)
+type listItem struct {
+	Squadron  string      `json:"squadron,omitempty" yaml:"squadron,omitempty"`
+	Name      string      `json:"name" yaml:"name"`
+	Enabled   bool        `json:"enabled" yaml:"enabled"`
+	Namespace string      `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Chart     listChart   `json:"chart" yaml:"chart"`
+	Builds    []listBuild `json:"builds,omitempty" yaml:"builds,omitempty"`
+	Tags      []string    `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+type listChart struct {
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	Version    string `json:"version,omitempty" yaml:"version,omitempty"`
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+}
+
+type listBuild struct {
+	Name  string `json:"name" yaml:"name"`
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+	Tag   string `json:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+func (i listItem) FullName() string {
+	if i.Squadron != "" {
+		return i.Squadron + "/" + i.Name
+	}
+	return i.Name
+}
+
+func list(args []string, cwd string, files []string, noRender bool, global map[string]interface{}) ([]listItem, error) {
+	sq, err := newSquadron(cwd, "", files, global)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
-		return err
+		return nil, err
+	}
+
+	if !noRender {
+		if err := sq.RenderConfig(); err != nil {
+			return nil, err
+		}
 	}
 
-	for name := range sq.GetConfig().Units {
-		fmt.Println(name)
+	units, err := parseUnitArgs(args, sq.GetConfig().Units)
+	if err != nil {
+		return nil, err
 	}
 
+	items := make([]listItem, 0, len(units))
+	for name, unit := range units {
+		items = append(items, newListItem(name, unit))
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+func newListItem(name string, unit squadron.Unit) listItem {
+	item := listItem{
+		Name:      name,
+		Enabled:   unit.IsEnabled(),
+		Namespace: unit.Namespace,
+		Chart: listChart{
+			Name:       unit.Chart.Name,
+			Version:    unit.Chart.Version,
+			Repository: unit.Chart.Repository,
+		},
+		Tags: unit.Tags,
+	}
+	for buildName, build := range unit.Builds {
+		item.Builds = append(item.Builds, listBuild{Name: buildName, Image: build.Image, Tag: build.Tag})
+	}
+	sort.Slice(item.Builds, func(i, j int) bool {
+		return item.Builds[i].Name < item.Builds[j].Name
+	})
+	return item
+}
+
+func printList(items []listItem, output string) error {
+	switch output {
+	case "names":
+		for _, item := range items {
+			fmt.Println(item.FullName())
+		}
+	case "json":
+		out, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "yaml":
+		out, err := yaml.Marshal(items)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tENABLED\tCHART\tVERSION\tREPOSITORY\tIMAGES\tTAGS")
+		for _, item := range items {
+			images := make([]string, 0, len(item.Builds))
+			for _, build := range item.Builds {
+				images = append(images, build.Image+":"+build.Tag)
+			}
+			fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\t%s\n", item.FullName(), item.Enabled, item.Chart.Name, item.Chart.Version,
+				item.Chart.Repository, strings.Join(images, ","), strings.Join(item.Tags, ","))
+		}
+		return w.Flush()
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
 	return nil
 }
@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/foomo/squadron"
+)
+
+func init() {
+	migrateCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "print the migrated files instead of writing them")
+}
+
+var migrateCmd = &cobra.Command{
+	Use:     "migrate",
+	Short:   "migrate squadron files to the current schema version",
+	Example: "  squadron migrate --file squadron.yaml --file squadron.override.yaml",
+	Args:    cobra.MinimumNArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return migrate(flagFiles, flagDryRun)
+	},
+}
+
+func migrate(files []string, dryRun bool) error {
+	for _, file := range files {
+		if ext := filepath.Ext(file); ext != ".yaml" && ext != ".yml" {
+			logrus.Warnf("skipping migration of non yaml file %q", file)
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		out, err := squadron.Migrate(data)
+		if err != nil {
+			return fmt.Errorf("failed to migrate %q: %w", file, err)
+		}
+		if bytes.Equal(data, out) {
+			logrus.Infof("%q is up to date", file)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("# %s\n%s", file, out)
+			continue
+		}
+		logrus.Infof("migrating %q to schema version %s", file, squadron.CurrentVersion)
+		if err := ioutil.WriteFile(file, out, info.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
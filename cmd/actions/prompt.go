@@ -0,0 +1,64 @@
+package actions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter() prompter {
+	return prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+}
+
+// isTerminal returns true if stdin is attached to a terminal i.e. the user can be prompted
+func isTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p prompter) ask(question, defaultValue string) (string, error) {
+	fmt.Fprintf(p.out, "%s [%s]: ", question, defaultValue)
+	answer, err := p.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
+
+func (p prompter) confirm(question string, defaultValue bool) (bool, error) {
+	options := "y/N"
+	if defaultValue {
+		options = "Y/n"
+	}
+	answer, err := p.ask(question, options)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return defaultValue, nil
+}
+
+// confirmTyped requires the user to type the expected value to confirm
+func (p prompter) confirmTyped(question, expected string) (bool, error) {
+	fmt.Fprintf(p.out, "%s\ntype %q to continue: ", question, expected)
+	answer, err := p.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return strings.TrimSpace(answer) == expected, nil
+}
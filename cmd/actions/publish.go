@@ -0,0 +1,61 @@
+package actions
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/foomo/squadron"
+)
+
+var flagRepository string
+
+func init() {
+	addOverrideFlags(publishCmd)
+	addPackageFlags(publishCmd)
+	publishCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "default", "specifies the namespace")
+	publishCmd.Flags().StringVar(&flagRepository, "repository", "", "OCI registry (oci://) or ChartMuseum compatible repository, defaults to chart.repository")
+}
+
+var publishCmd = &cobra.Command{
+	Use:     "publish",
+	Short:   "package and push the umbrella chart to a chart repository",
+	Example: "  squadron publish --repository oci://registry.example.com/charts --version 1.0.0",
+	Args:    cobra.MinimumNArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return publish(cwd, flagNamespace, files, flagRepository, global)
+			})
+		}
+		return publish(basePath, flagNamespace, flagFiles, flagRepository, nil)
+	},
+}
+
+func publish(cwd, namespace string, files []string, repository string, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, namespace, files, global)
+	if err != nil {
+		return err
+	}
+
+	if err := sq.MergeConfigFiles(); err != nil {
+		return err
+	}
+
+	if err := sq.Override(flagSet, flagSetString, flagSetFile); err != nil {
+		return err
+	}
+
+	if err := sq.RenderConfig(); err != nil {
+		return err
+	}
+
+	if repository == "" {
+		repository = sq.GetConfig().Chart.Repository
+	}
+
+	file, err := sq.Package(flagDestination, flagVersion)
+	if err != nil {
+		return err
+	}
+
+	return squadron.PublishChart(file, repository)
+}
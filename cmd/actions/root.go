@@ -1,7 +1,9 @@
 package actions
 
 import (
+	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,25 +29,64 @@ var (
 			if err = util.ValidatePath(".", &cwd); err != nil {
 				return err
 			}
+			basePath = cwd
+			// discover the config files unless given explicitly, paths passed as flags stay relative to the cwd
+			if !flagNoDiscover && !flagWorkspace && !cmd.Flags().Changed("file") {
+				dir, files, err := squadron.Discover(cwd, flagProfile)
+				if err != nil {
+					logrus.Debug(err)
+					return nil
+				}
+				logrus.Debugf("discovered squadron files %v", files)
+				basePath, flagFiles = dir, files
+			}
 			return nil
 		},
 	}
 
-	cwd           string
-	flagVerbose   bool
-	flagNoRender  bool
-	flagNamespace string
-	flagBuild     bool
-	flagPush      bool
-	flagDiff      bool
-	flagFiles     []string
+	cwd            string
+	basePath       string
+	flagVerbose    bool
+	flagNoDiscover bool
+	flagWorkspace  bool
+	flagNoRender   bool
+	flagNamespace  string
+	flagOutput     string
+	flagBuild      bool
+	flagPush       bool
+	flagDiff       bool
+	flagDryRun     bool
+	flagFiles      []string
+	flagEnvFiles   []string
+	flagProfile    string
+	flagSetVars    []string
+	flagSet        []string
+	flagSetString  []string
+	flagSetFile    []string
+	flagTags       []string
+	flagSelectors  []string
+
+	flagSecretCacheTTL  time.Duration
+	flagCreateNamespace bool
+	flagKubeContext     string
+	flagYes             bool
 )
 
+const envSecretCacheKey = "SQUADRON_SECRET_CACHE_KEY"
+
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&flagVerbose, "verbose", "v", false, "show more output")
 	rootCmd.PersistentFlags().StringSliceVarP(&flagFiles, "file", "f", []string{"squadron.yaml"}, "specify alternative squadron files")
+	rootCmd.PersistentFlags().BoolVarP(&flagWorkspace, "workspace", "w", false, "run on all squadrons of the nearest squadron-workspace.yaml")
+	rootCmd.PersistentFlags().BoolVar(&flagNoDiscover, "no-discover", false, "don't look up squadron files in parent directories")
+	rootCmd.PersistentFlags().StringVar(&flagProfile, "profile", "", "specifies the profile used to discover squadron.<profile>.yaml and exposed to templates as .Profile")
+	rootCmd.PersistentFlags().StringArrayVar(&flagSetVars, "set-var", nil, "set template variables exposed as .Vars (key=value)")
+	rootCmd.PersistentFlags().StringSliceVar(&flagEnvFiles, "env-file", nil, "load env variables from the given files before rendering")
+	rootCmd.PersistentFlags().StringVar(&flagKubeContext, "kube-context", "", "kube context passed to all helm and kubectl calls")
+	rootCmd.PersistentFlags().DurationVar(&flagSecretCacheTTL, "secret-cache-ttl", 0,
+		"cache fetched secrets encrypted on disk for the given duration (requires "+envSecretCacheKey+")")
 
-	rootCmd.AddCommand(upCmd, downCmd, buildCmd, listCmd, generateCmd, configCmd, versionCmd, completionCmd, templateCmd)
+	rootCmd.AddCommand(upCmd, downCmd, buildCmd, listCmd, generateCmd, configCmd, versionCmd, completionCmd, templateCmd, migrateCmd, initCmd, unitCmd, publishCmd)
 }
 
 func Execute() {
@@ -54,6 +95,37 @@ func Execute() {
 	}
 }
 
+// addOverrideFlags helper
+func addOverrideFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&flagSet, "set", nil, "set values on the command line (path.to.key=value)")
+	cmd.Flags().StringArrayVar(&flagSetString, "set-string", nil, "set STRING values on the command line (path.to.key=value)")
+	cmd.Flags().StringArrayVar(&flagSetFile, "set-file", nil, "set values from respective files on the command line (path.to.key=path)")
+}
+
+// newSquadron helper, global holds the values inherited from the workspace
+func newSquadron(cwd, namespace string, files []string, global map[string]interface{}) (*squadron.Squadron, error) {
+	sq := squadron.New(cwd, namespace, files)
+	sq.InheritGlobal(global)
+	sq.AddEnvFiles(flagEnvFiles...)
+	sq.SetProfile(flagProfile)
+	sq.SetKubeContext(flagKubeContext)
+	for _, v := range flagSetVars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid template variable %q, expected key=value", v)
+		}
+		sq.SetVar(parts[0], parts[1])
+	}
+	if flagSecretCacheTTL > 0 {
+		key := os.Getenv(envSecretCacheKey)
+		if key == "" {
+			return nil, errors.Errorf("secret cache requires the %s env variable", envSecretCacheKey)
+		}
+		sq.SetSecretCache(flagSecretCacheTTL, key)
+	}
+	return sq, nil
+}
+
 // parseExtraArgs ...
 func parseExtraArgs(args []string) (out []string, extraArgs []string) {
 	for i, arg := range args {
@@ -66,18 +138,17 @@ func parseExtraArgs(args []string) (out []string, extraArgs []string) {
 	return args, nil
 }
 
-// parseUnitArgs helper
+// addSelectorFlags helper
+func addSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&flagTags, "tag", nil, "select units by tag, supports globs and exclusions (!tag)")
+	cmd.Flags().StringArrayVarP(&flagSelectors, "selector", "l", nil, "select units by key=value or key!=value tags")
+}
+
+// parseUnitArgs helper selects units by name patterns and the selector flags
 func parseUnitArgs(args []string, units map[string]squadron.Unit) (map[string]squadron.Unit, error) {
-	if len(args) == 0 {
+	selector := squadron.UnitSelector{Names: args, Tags: append(append([]string{}, flagTags...), flagSelectors...)}
+	if selector.Empty() {
 		return units, nil
 	}
-	ret := map[string]squadron.Unit{}
-	for _, arg := range args {
-		if unit, ok := units[arg]; ok {
-			ret[arg] = unit
-		} else {
-			return nil, errors.Errorf("unknown unit name %s", arg)
-		}
-	}
-	return ret, nil
+	return selector.Select(units)
 }
@@ -2,11 +2,11 @@ package actions
 
 import (
 	"github.com/spf13/cobra"
-
-	"github.com/foomo/squadron"
 )
 
 func init() {
+	addSelectorFlags(templateCmd)
+	addOverrideFlags(templateCmd)
 	templateCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "default", "specifies the namespace")
 }
 
@@ -16,17 +16,29 @@ var templateCmd = &cobra.Command{
 	Example: "  squadron template frontend backend --namespace demo",
 	Args:    cobra.MinimumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return template(args, cwd, flagNamespace, flagFiles)
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return template(args, cwd, flagNamespace, files, global)
+			})
+		}
+		return template(args, basePath, flagNamespace, flagFiles, nil)
 	},
 }
 
-func template(args []string, cwd, namespace string, files []string) error {
-	sq := squadron.New(cwd, namespace, files)
+func template(args []string, cwd, namespace string, files []string, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, namespace, files, global)
+	if err != nil {
+		return err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
 		return err
 	}
 
+	if err := sq.Override(flagSet, flagSetString, flagSetFile); err != nil {
+		return err
+	}
+
 	if err := sq.RenderConfig(); err != nil {
 		return err
 	}
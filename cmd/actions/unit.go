@@ -0,0 +1,105 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/foomo/squadron"
+)
+
+var flagUnitSpec squadron.UnitSpec
+
+func init() {
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.Chart, "chart", "", "local chart path or chart name when used with --chart-repository")
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.ChartRepository, "chart-repository", "", "repository of the chart")
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.ChartVersion, "chart-version", "", "version of the chart")
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.Context, "build-context", "", "docker build context of the default build")
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.Dockerfile, "build-dockerfile", "", "dockerfile relative to the build context")
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.Image, "build-image", "", "image of the default build, defaults to the unit name")
+	unitAddCmd.Flags().StringVar(&flagUnitSpec.Tag, "build-tag", "", "tag of the default build, defaults to latest")
+	unitCmd.AddCommand(unitAddCmd, unitRemoveCmd)
+}
+
+var unitCmd = &cobra.Command{
+	Use:   "unit",
+	Short: "edit the units of the squadron file",
+}
+
+var unitAddCmd = &cobra.Command{
+	Use:     "add [UNIT]",
+	Short:   "adds a unit to the squadron file",
+	Example: "  squadron unit add frontend --chart ./frontend/chart --build-context ./frontend",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spec := flagUnitSpec
+		spec.Name = args[0]
+		// flag paths are relative to the cwd while the squadron file resolves them against its own directory
+		dir := filepath.Dir(flagFiles[0])
+		if spec.ChartRepository == "" {
+			spec.Chart = relativePath(dir, spec.Chart)
+		}
+		spec.Context = relativePath(dir, spec.Context)
+		return editUnits(flagFiles[0], func(data []byte) ([]byte, error) {
+			return squadron.AddUnit(data, spec)
+		})
+	},
+}
+
+var unitRemoveCmd = &cobra.Command{
+	Use:     "remove [UNIT]",
+	Aliases: []string{"rm"},
+	Short:   "removes a unit from the squadron file",
+	Example: "  squadron unit remove frontend",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editUnits(flagFiles[0], func(data []byte) ([]byte, error) {
+			return squadron.RemoveUnit(data, args[0])
+		})
+	},
+}
+
+// editUnits rewrites the squadron file in place
+func editUnits(file string, edit func(data []byte) ([]byte, error)) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	out, err := edit(data)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("updating %q", file)
+	return ioutil.WriteFile(file, out, info.Mode())
+}
+
+// relativePath rewrites the relative path to be relative to the given directory
+func relativePath(dir, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return p
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return p
+	}
+	if rel = filepath.ToSlash(rel); rel != "." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
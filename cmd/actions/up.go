@@ -4,33 +4,47 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-
-	"github.com/foomo/squadron"
 )
 
 func init() {
+	addSelectorFlags(upCmd)
+	addOverrideFlags(upCmd)
 	upCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "default", "specifies the namespace")
 	upCmd.Flags().BoolVarP(&flagBuild, "build", "b", false, "builds or rebuilds units")
 	upCmd.Flags().BoolVarP(&flagPush, "push", "p", false, "pushes units to the registry")
 	upCmd.Flags().BoolVar(&flagDiff, "diff", false, "preview upgrade as a coloured diff")
+	upCmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "skip the confirmation of protected squadrons")
+	upCmd.Flags().BoolVar(&flagCreateNamespace, "create-namespace", false, "creates missing namespaces before installing")
 }
 
 var upCmd = &cobra.Command{
 	Use:     "up [UNIT...]",
 	Short:   "installs the squadron or given units",
-	Example: "  squadron up frontend backend --namespace demo --build --push -- --dry-run",
+	Example: "  squadron up frontend backend --namespace demo --build --push -- --dry-run\n  squadron up -l tier=backend '!legacy'",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return up(args, cwd, flagNamespace, flagBuild, flagPush, flagDiff, flagFiles)
+		if flagWorkspace {
+			return workspace(args, func(name string, args []string, cwd string, files []string, global map[string]interface{}) error {
+				return up(args, cwd, flagNamespace, flagBuild, flagPush, flagDiff, files, global)
+			})
+		}
+		return up(args, basePath, flagNamespace, flagBuild, flagPush, flagDiff, flagFiles, nil)
 	},
 }
 
-func up(args []string, cwd, namespace string, build, push, diff bool, files []string) error {
-	sq := squadron.New(cwd, namespace, files)
+func up(args []string, cwd, namespace string, build, push, diff bool, files []string, global map[string]interface{}) error {
+	sq, err := newSquadron(cwd, namespace, files, global)
+	if err != nil {
+		return err
+	}
 
 	if err := sq.MergeConfigFiles(); err != nil {
 		return err
 	}
 
+	if err := sq.Override(flagSet, flagSetString, flagSetFile); err != nil {
+		return err
+	}
+
 	if err := sq.RenderConfig(); err != nil {
 		return err
 	}
@@ -41,6 +55,16 @@ func up(args []string, cwd, namespace string, build, push, diff bool, files []st
 		return err
 	}
 
+	if err := guardKubeContext(sq, units); err != nil {
+		return err
+	}
+
+	if !diff {
+		if err := guardProtected(sq, units, "install", false, flagYes); err != nil {
+			return err
+		}
+	}
+
 	if build {
 		for _, unit := range units {
 			if err := unit.Build(); err != nil {
@@ -62,6 +86,11 @@ func up(args []string, cwd, namespace string, build, push, diff bool, files []st
 	}
 
 	if !diff {
+		if flagCreateNamespace {
+			if err := sq.CreateNamespaces(units); err != nil {
+				return err
+			}
+		}
 		return sq.Up(units, helmArgs)
 	} else if out, err := sq.Diff(units, helmArgs); err != nil {
 		return err
@@ -0,0 +1,113 @@
+package actions
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/foomo/squadron"
+)
+
+// workspace runs fn for each squadron selected by `squadron/unit` args within the workspace
+// passing the global values of the workspace to be inherited by the squadron
+func workspace(args []string, fn func(name string, args []string, cwd string, files []string, global map[string]interface{}) error) error {
+	ws, err := squadron.DiscoverWorkspace(cwd)
+	if err != nil {
+		return err
+	}
+	dirs, err := ws.SquadronDirs()
+	if err != nil {
+		return err
+	}
+	args, extraArgs := parseExtraArgs(args)
+	selected, err := parseWorkspaceArgs(args, dirs)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, files, err := squadron.Discover(dirs[name], flagProfile)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("running squadron %s in %s", name, dirs[name])
+		if err := fn(name, append(selected[name], extraArgs...), dirs[name], files, ws.Global); err != nil {
+			return errors.Wrapf(err, "squadron %s", name)
+		}
+	}
+	return nil
+}
+
+// parseWorkspaceArgs helper returns the unit args by squadron, nil selects all units
+func parseWorkspaceArgs(args []string, dirs map[string]string) (map[string][]string, error) {
+	var includes, excludes []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "!") {
+			excludes = append(excludes, strings.TrimPrefix(arg, "!"))
+		} else {
+			includes = append(includes, arg)
+		}
+	}
+	ret, err := parseWorkspaceIncludes(includes, dirs)
+	if err != nil {
+		return nil, err
+	}
+	// `!squadron` drops the squadron while `!squadron/unit` excludes the unit
+	for _, arg := range excludes {
+		parts := strings.SplitN(arg, "/", 2)
+		for name := range ret {
+			if ok, err := path.Match(parts[0], name); err != nil {
+				return nil, errors.Wrapf(err, "invalid squadron pattern %q", parts[0])
+			} else if !ok {
+				continue
+			}
+			if len(parts) == 1 || parts[1] == "" || parts[1] == "*" {
+				delete(ret, name)
+			} else {
+				ret[name] = append(ret[name], "!"+parts[1])
+			}
+		}
+	}
+	return ret, nil
+}
+
+func parseWorkspaceIncludes(args []string, dirs map[string]string) (map[string][]string, error) {
+	ret := map[string][]string{}
+	if len(args) == 0 {
+		for name := range dirs {
+			ret[name] = nil
+		}
+		return ret, nil
+	}
+	all := map[string]bool{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "/", 2)
+		var matched bool
+		for name := range dirs {
+			if ok, err := path.Match(parts[0], name); err != nil {
+				return nil, errors.Wrapf(err, "invalid squadron pattern %q", parts[0])
+			} else if !ok {
+				continue
+			}
+			matched = true
+			if len(parts) == 1 || parts[1] == "" || parts[1] == "*" {
+				all[name] = true
+				ret[name] = nil
+			} else if !all[name] {
+				ret[name] = append(ret[name], parts[1])
+			}
+		}
+		if !matched {
+			return nil, errors.Errorf("unknown squadron name %s", parts[0])
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,49 @@
+package squadron
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	configFile         = "squadron.yaml"
+	configOverrideFile = "squadron.override.yaml"
+	configProfileFile  = "squadron.%s.yaml"
+)
+
+// Discover walks up from dir to the nearest squadron.yaml and returns its directory along with
+// the conventional profile and override files found next to it
+func Discover(dir, profile string) (string, []string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		if fileExists(filepath.Join(dir, configFile)) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, errors.Errorf("could not find %s in any parent directory", configFile)
+		}
+		dir = parent
+	}
+	files := []string{filepath.Join(dir, configFile)}
+	if profile != "" {
+		if file := filepath.Join(dir, fmt.Sprintf(configProfileFile, profile)); fileExists(file) {
+			files = append(files, file)
+		}
+	}
+	if file := filepath.Join(dir, configOverrideFile); fileExists(file) {
+		files = append(files, file)
+	}
+	return dir, files, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
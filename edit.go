@@ -0,0 +1,118 @@
+package squadron
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// UnitSpec describes a unit to be added to a squadron file
+type UnitSpec struct {
+	Name string
+	// Chart is a local chart path or the chart name when ChartRepository is set
+	Chart           string
+	ChartRepository string
+	ChartVersion    string
+	Context         string
+	Dockerfile      string
+	Image           string
+	Tag             string
+}
+
+// AddUnit adds the unit to the squadron file content while preserving comments and ordering
+func AddUnit(data []byte, spec UnitSpec) ([]byte, error) {
+	if spec.Name == "" {
+		return nil, errors.New("missing unit name")
+	}
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	units := mappingValue(doc, "squadron")
+	if units == nil || units.Kind != yaml.MappingNode {
+		units = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if key, value := mappingEntry(doc, "squadron"); key != nil {
+			*value = *units
+			units = value
+		} else {
+			root := doc.Content[0]
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "squadron"}, units)
+		}
+	}
+	if mappingValue(units, spec.Name) != nil {
+		return nil, errors.Errorf("unit %q already exists", spec.Name)
+	}
+	uc := scaffoldUnitConfig{}
+	switch {
+	case spec.ChartRepository != "":
+		uc.Chart = ChartDependency{Name: spec.Chart, Repository: spec.ChartRepository, Version: spec.ChartVersion}
+	case spec.Chart != "":
+		uc.Chart = spec.Chart
+	}
+	if spec.Context != "" || spec.Image != "" {
+		image, tag := spec.Image, spec.Tag
+		if image == "" {
+			image = spec.Name
+		}
+		if tag == "" {
+			tag = "latest"
+		}
+		uc.Builds = map[string]Build{
+			"default": {Image: image, Tag: tag, Context: spec.Context, Dockerfile: spec.Dockerfile},
+		}
+	}
+	value := &yaml.Node{}
+	if err := value.Encode(uc); err != nil {
+		return nil, err
+	}
+	units.Content = append(units.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: spec.Name}, value)
+	return marshalValidDocument(doc)
+}
+
+// RemoveUnit removes the unit from the squadron file content while preserving comments and ordering
+func RemoveUnit(data []byte, name string) ([]byte, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	units := mappingValue(doc, "squadron")
+	if units == nil || units.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("unit %q not found", name)
+	}
+	for i := 0; i+1 < len(units.Content); i += 2 {
+		if units.Content[i].Value == name {
+			units.Content = append(units.Content[:i], units.Content[i+2:]...)
+			return marshalValidDocument(doc)
+		}
+	}
+	return nil, errors.Errorf("unit %q not found", name)
+}
+
+func parseDocument(data []byte) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse squadron file")
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	} else if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("squadron file must contain a mapping")
+	}
+	return doc, nil
+}
+
+// marshalValidDocument marshals the document after making sure it is still a valid squadron file
+func marshalValidDocument(doc *yaml.Node) ([]byte, error) {
+	out, err := marshalNode(doc)
+	if err != nil {
+		return nil, err
+	}
+	c := Configuration{}
+	if err := yaml.Unmarshal(out, &c); err != nil {
+		return nil, errors.Wrap(err, "invalid squadron file")
+	}
+	if err := validateVersion(c.Version); err != nil {
+		return nil, errors.Wrap(err, "invalid squadron file")
+	}
+	return out, nil
+}
@@ -0,0 +1,84 @@
+package squadron
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KubeContextError is returned if the kube context isn't allowed for a namespace
+type KubeContextError struct {
+	Context   string
+	Cluster   string
+	Namespace string
+	Allowed   []string
+}
+
+func (e *KubeContextError) Error() string {
+	return fmt.Sprintf("kube context %q (cluster %q) is not allowed for namespace %q, expected one of: %s",
+		e.Context, e.Cluster, e.Namespace, strings.Join(e.Allowed, ", "))
+}
+
+// KubeContext returns the kube context which is either set explicitly or the current one
+func (sq *Squadron) KubeContext() (string, error) {
+	if sq.kubeContext != "" {
+		return sq.kubeContext, nil
+	}
+	return sq.kubeCmd().CurrentContext()
+}
+
+// ValidateKubeContext returns a *KubeContextError if the kube context isn't allowed for any namespace of the units
+func (sq *Squadron) ValidateKubeContext(units map[string]Unit) error {
+	if len(sq.c.KubeContexts) == 0 {
+		return nil
+	}
+	context, err := sq.KubeContext()
+	if err != nil {
+		return err
+	}
+	cluster, err := sq.kubeCmd().ContextCluster(context)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("using kube context %q on cluster %q", context, cluster)
+	return sq.CheckKubeContext(context, cluster, units)
+}
+
+// CheckKubeContext returns a *KubeContextError if neither the context nor the cluster are allowed for any namespace of the units
+func (sq *Squadron) CheckKubeContext(context, cluster string, units map[string]Unit) error {
+	for _, namespace := range sq.unitNamespaces(units) {
+		var allowed []string
+		for pattern, names := range sq.c.KubeContexts {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				allowed = append(allowed, names...)
+			}
+		}
+		if len(allowed) == 0 || matchAny(allowed, context) || (cluster != "" && matchAny(allowed, cluster)) {
+			continue
+		}
+		sort.Strings(allowed)
+		return &KubeContextError{Context: context, Cluster: cluster, Namespace: namespace, Allowed: allowed}
+	}
+	return nil
+}
+
+// unitNamespaces returns the sorted namespaces of the enabled units
+func (sq *Squadron) unitNamespaces(units map[string]Unit) []string {
+	namespaces := map[string]bool{sq.namespace: sq.c.Unite || len(units) == 0}
+	for _, u := range units {
+		if u.IsEnabled() {
+			namespaces[sq.unitNamespace(u)] = true
+		}
+	}
+	var ret []string
+	for namespace, ok := range namespaces {
+		if ok {
+			ret = append(ret, namespace)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,280 @@
+package squadron
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the latest squadron file schema version
+const CurrentVersion = "2.0"
+
+// legacyDelimsMarker marks converted `{{ }}` delimiters until their location is known
+const legacyDelimsMarker = "\uE000"
+
+var (
+	legacyDelimsRegex = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	markedDelimsRegex = regexp.MustCompile(`<%` + legacyDelimsMarker + `(.*?)%>`)
+	// squadronActionRegex matches actions which can't be helm templates as they use squadron variables or functions
+	squadronActionRegex = regexp.MustCompile(`\.(Global|Squadron|Units|Unit|Vars|Profile|Cwd)\b|\b(env|requiredEnv|op|file|git)\s`)
+	legacyBuildRefRegex = regexp.MustCompile(`(\.Squadron\.([\w-]+)|\.Unit)\.[Bb]uild\b`)
+	versionRegex        = regexp.MustCompile(`(?m)^version:\s*["']?([\d.]+)["']?`)
+)
+
+type migration struct {
+	from string
+	// text migrates the raw file content before it is being parsed
+	text func(data []byte) []byte
+	// node migrates the parsed document and returns notes on what needs to be checked manually
+	node func(doc *yaml.Node) ([]string, error)
+}
+
+// migrations to the next version ordered by version
+var migrations = []migration{
+	{
+		from: "1.0",
+		text: func(data []byte) []byte {
+			// `{{ }}` delimiters were replaced by `<% %>`, mark them as they're only invalid yaml outside of strings
+			return legacyDelimsRegex.ReplaceAll(data, []byte("<%"+legacyDelimsMarker+"$1%>"))
+		},
+		node: func(doc *yaml.Node) ([]string, error) {
+			// a single `build` was replaced by named `builds`
+			renamed := map[string]bool{}
+			if units := mappingValue(doc, "squadron"); units != nil && units.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(units.Content); i += 2 {
+					unit := units.Content[i+1]
+					key, value := mappingEntry(unit, "build")
+					if key == nil || mappingValue(unit, "builds") != nil {
+						continue
+					}
+					renamed[units.Content[i].Value] = true
+					key.Value = "builds"
+					*value = yaml.Node{
+						Kind:    yaml.MappingNode,
+						Tag:     "!!map",
+						Content: []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: "default"}, copyNode(value)},
+					}
+				}
+			}
+			var notes []string
+			walkScalars(doc, nil, func(path []string, node *yaml.Node) {
+				var unit string
+				if len(path) > 1 && path[0] == "squadron" {
+					unit = path[1]
+				}
+				// values are passed to helm, so only actions using squadron variables or functions are converted
+				helmValues := path[0] == "global" || (unit != "" && len(path) > 2 && path[2] == "values")
+				node.Value = markedDelimsRegex.ReplaceAllStringFunc(node.Value, func(match string) string {
+					action := markedDelimsRegex.FindStringSubmatch(match)[1]
+					if helmValues && !squadronActionRegex.MatchString(action) {
+						notes = append(notes, fmt.Sprintf("kept `{{%s}}` in %s as it might be a helm template, use `<%%%s%%>` to render it with squadron",
+							action, strings.Join(path, "."), action))
+						return "{{" + action + "}}"
+					}
+					return "<%" + action + "%>"
+				})
+				// references to the renamed builds
+				node.Value = legacyBuildRefRegex.ReplaceAllStringFunc(node.Value, func(match string) string {
+					m := legacyBuildRefRegex.FindStringSubmatch(match)
+					if (m[2] != "" && renamed[m[2]]) || (m[2] == "" && renamed[unit]) {
+						return m[1] + ".builds.default"
+					}
+					return match
+				})
+			})
+			return notes, nil
+		},
+	},
+}
+
+// walkScalars calls fn with the key path of every scalar value containing template actions
+func walkScalars(node *yaml.Node, path []string, fn func(path []string, node *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkScalars(child, path, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkScalars(node.Content[i+1], append(append([]string{}, path...), node.Content[i].Value), fn)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			walkScalars(child, append(append([]string{}, path...), strconv.Itoa(i)), fn)
+		}
+	case yaml.ScalarNode:
+		if len(path) > 0 && strings.Contains(node.Value, "<%") {
+			fn(path, node)
+		}
+	}
+}
+
+// validateVersion returns an error for unknown or future schema versions
+func validateVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+	v, err := normalizeVersion(version)
+	if err != nil {
+		return err
+	}
+	if v == CurrentVersion || migrationIndex(v) >= 0 {
+		return nil
+	}
+	current, _ := parseVersion(CurrentVersion)
+	if parsed, _ := parseVersion(v); parsed[0] > current[0] || (parsed[0] == current[0] && parsed[1] > current[1]) {
+		return errors.Errorf("unsupported schema version %q, please upgrade squadron (supports up to %s)", version, CurrentVersion)
+	}
+	return errors.Errorf("unknown schema version %q", version)
+}
+
+// olderVersion returns true for versions which are migrated to the current one
+func olderVersion(version string) bool {
+	v, err := normalizeVersion(version)
+	return err == nil && migrationIndex(v) >= 0
+}
+
+// Migrate rewrites the squadron file content to the current schema version while preserving comments,
+// files without a version i.e. overrides are considered to be of the current version just like when being loaded
+func Migrate(data []byte) ([]byte, error) {
+	version := CurrentVersion
+	if match := versionRegex.FindSubmatch(data); match != nil {
+		version = string(match[1])
+	}
+	out, notes, err := migrate(data, version)
+	for _, note := range notes {
+		logrus.Warn(note)
+	}
+	return out, err
+}
+
+// migrate migrates the content of the given version and returns notes on what needs to be checked manually
+func migrate(data []byte, version string) ([]byte, []string, error) {
+	if err := validateVersion(version); err != nil {
+		return nil, nil, err
+	}
+	version, _ = normalizeVersion(version)
+	i := migrationIndex(version)
+	if i < 0 {
+		return data, nil, nil
+	}
+	for _, m := range migrations[i:] {
+		if m.text != nil {
+			data = m.text(data)
+		}
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse squadron file")
+	}
+	var notes []string
+	for _, m := range migrations[i:] {
+		if m.node != nil {
+			n, err := m.node(doc)
+			if err != nil {
+				return nil, nil, err
+			}
+			notes = append(notes, n...)
+		}
+	}
+	if node := mappingValue(doc, "version"); node != nil {
+		node.Value, node.Tag, node.Style = CurrentVersion, "!!str", yaml.DoubleQuotedStyle
+	} else if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		doc.Content[0].Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: CurrentVersion, Style: yaml.DoubleQuotedStyle},
+		}, doc.Content[0].Content...)
+	}
+	out, err := marshalNode(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	// keep unconverted delimiters i.e. within comments
+	return markedDelimsRegex.ReplaceAll(out, []byte("{{$1}}")), notes, nil
+}
+
+// marshalNode encodes the node with the indentation used throughout squadron files
+func marshalNode(node *yaml.Node) ([]byte, error) {
+	out := bytes.NewBuffer([]byte{})
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// migrationIndex returns the index of the migration starting at the given version
+func migrationIndex(version string) int {
+	for i, m := range migrations {
+		if m.from == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeVersion(version string) (string, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d", v[0], v[1]), nil
+}
+
+func parseVersion(version string) ([2]int, error) {
+	var ret [2]int
+	parts := strings.SplitN(version, ".", 2)
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return ret, errors.Errorf("invalid schema version %q", version)
+		}
+		ret[i] = v
+	}
+	return ret, nil
+}
+
+// mappingEntry returns the key and value nodes for the given key of a mapping or document node
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(node, key)
+	return value
+}
+
+func copyNode(node *yaml.Node) *yaml.Node {
+	ret := *node
+	return &ret
+}
+
+// versionString returns the version as declared i.e. unquoted versions are parsed as numbers
+func versionString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,141 @@
+package squadron
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var overrideKeyRegex = regexp.MustCompile(`^(.+?)\[(\d+)\]$`)
+
+// overrideType defines how the value of a helm style override is interpreted
+type overrideType int
+
+const (
+	overrideTypeTyped overrideType = iota
+	overrideTypeString
+	overrideTypeFile
+)
+
+// applyOverrides sets the comma separated `path.to.key=value` pairs on data
+func applyOverrides(data map[string]interface{}, overrides []string, typ overrideType) error {
+	for _, override := range overrides {
+		for _, pair := range splitEscaped(override, ',') {
+			if pair == "" {
+				continue
+			}
+			parts := splitEscaped(pair, '=')
+			if len(parts) < 2 || parts[0] == "" {
+				return errors.Errorf("invalid override %q, expected path.to.key=value", pair)
+			}
+			rawValue := unescape(strings.Join(parts[1:], "="))
+			var value interface{}
+			switch typ {
+			case overrideTypeTyped:
+				value = typedOverrideValue(rawValue)
+			case overrideTypeString:
+				value = rawValue
+			case overrideTypeFile:
+				bs, err := ioutil.ReadFile(rawValue)
+				if err != nil {
+					return errors.Wrapf(err, "failed to read override file for %q", parts[0])
+				}
+				value = string(bs)
+			}
+			var path []string
+			for _, key := range splitEscaped(parts[0], '.') {
+				path = append(path, unescape(key))
+			}
+			if err := setOverride(data, path, value); err != nil {
+				return errors.Wrapf(err, "failed to set override %q", parts[0])
+			}
+		}
+	}
+	return nil
+}
+
+func setOverride(data map[string]interface{}, path []string, value interface{}) error {
+	key, index := path[0], -1
+	if match := overrideKeyRegex.FindStringSubmatch(key); match != nil {
+		key = match[1]
+		index, _ = strconv.Atoi(match[2])
+	}
+	if index < 0 {
+		if len(path) == 1 {
+			data[key] = value
+			return nil
+		}
+		child, ok := data[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			data[key] = child
+		}
+		return setOverride(child, path[1:], value)
+	}
+	list, ok := data[key].([]interface{})
+	if !ok && data[key] != nil {
+		return errors.Errorf("%q is not a list", key)
+	}
+	for len(list) <= index {
+		list = append(list, nil)
+	}
+	data[key] = list
+	if len(path) == 1 {
+		list[index] = value
+		return nil
+	}
+	child, ok := list[index].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		list[index] = child
+	}
+	return setOverride(child, path[1:], value)
+}
+
+// typedOverrideValue interprets the value the same way helm does for --set
+func typedOverrideValue(v string) interface{} {
+	switch strings.ToLower(v) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	case "0":
+		return int64(0)
+	}
+	// leading zeros are kept as strings
+	if !strings.HasPrefix(v, "0") {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	}
+	return v
+}
+
+// splitEscaped splits s by sep unless it is escaped by a backslash
+func splitEscaped(s string, sep byte) []string {
+	var ret []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			current.WriteByte(s[i])
+			current.WriteByte(s[i+1])
+			i++
+		case s[i] == sep:
+			ret = append(ret, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(ret, current.String())
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\.`, ".", `\=`, "=", `\\`, `\`).Replace(s)
+}
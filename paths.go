@@ -0,0 +1,261 @@
+package squadron
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/miracl/conflate"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	localChartRepositoryPrefix = "file://"
+	includesKey                = "includes"
+)
+
+var (
+	pwdRegex          = regexp.MustCompile(`\$\{PWD\}`)
+	fileFunctionRegex = regexp.MustCompile(`\bfile\s+"([^"]*)"`)
+	gitFunctionRegex  = regexp.MustCompile(`\bgit\s+"[^"]*"\s+"([^"]*)"`)
+)
+
+// loadConfigFile reads a single squadron file along with its includes and resolves
+// their relative paths against the directory of the declaring file
+func loadConfigFile(file, basePath string, parents ...string) (map[string]interface{}, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, parent := range parents {
+		if parent == absFile {
+			return nil, errors.Errorf("squadron file %q recursively includes itself", file)
+		}
+	}
+	data, err := readConfigFile(file)
+	if err != nil {
+		return nil, err
+	}
+	absBasePath, err := filepath.Abs(basePath)
+	if err != nil {
+		return nil, err
+	}
+	r := pathResolver{dir: filepath.Dir(absFile), basePath: absBasePath}
+	if value := r.expand(data); value != nil {
+		data, _ = value.(map[string]interface{})
+	}
+	if files, ok := data["env_files"].([]interface{}); ok {
+		for i, file := range files {
+			if f, ok := file.(string); ok {
+				files[i] = r.resolve(f)
+			}
+		}
+	}
+	if chart, ok := data["chart"].(map[string]interface{}); ok {
+		if templates, ok := chart["templates"].([]interface{}); ok {
+			for i, template := range templates {
+				if t, ok := template.(string); ok {
+					templates[i] = r.resolve(t)
+				}
+			}
+		}
+	}
+	if units, ok := data["squadron"].(map[string]interface{}); ok {
+		for _, unit := range units {
+			if u, ok := unit.(map[string]interface{}); ok {
+				r.resolveUnit(u)
+			}
+		}
+	}
+	return r.mergeIncludes(data, absFile, basePath, parents)
+}
+
+// mergeIncludes loads the files listed in `includes` and merges the declaring file's data on top of them
+func (r pathResolver) mergeIncludes(data map[string]interface{}, file, basePath string, parents []string) (map[string]interface{}, error) {
+	includes, ok := data[includesKey]
+	if !ok {
+		return data, nil
+	}
+	delete(data, includesKey)
+	list, ok := includes.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid includes in squadron file %q", file)
+	}
+	objs := make([]interface{}, 0, len(list)+1)
+	for _, include := range list {
+		i, ok := include.(string)
+		if !ok || i == "" {
+			return nil, errors.Errorf("invalid include %v in squadron file %q", include, file)
+		}
+		obj, err := loadConfigFile(r.resolve(i), basePath, append(parents, file)...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to include %q in %q", i, file)
+		}
+		objs = append(objs, obj)
+	}
+	merged, err := conflate.FromGo(append(objs, data)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to merge the includes of %q", file)
+	}
+	ret := map[string]interface{}{}
+	if err := merged.Unmarshal(&ret); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal %q", file)
+	}
+	return ret, nil
+}
+
+// readConfigFile reads a squadron file migrating older schema versions in memory
+func readConfigFile(file string) (map[string]interface{}, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// older yaml files might be invalid before being migrated i.e. due to `{{ }}` delimiters
+	if match := versionRegex.FindSubmatch(raw); match != nil && isYAMLFile(file) && olderVersion(string(match[1])) {
+		return migrateConfigFile(file, raw, string(match[1]))
+	}
+	config, err := conflate.FromFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	if err := config.Unmarshal(&data); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal %q", file)
+	}
+	version := versionString(data["version"])
+	if err := validateVersion(version); err != nil {
+		return nil, errors.Wrapf(err, "invalid squadron file %q", file)
+	} else if !olderVersion(version) {
+		return data, nil
+	} else if filepath.Ext(file) == ".json" {
+		return migrateConfigFile(file, raw, version)
+	}
+	logrus.Warnf("squadron file %q uses schema version %s which can't be migrated, please upgrade it to %s manually", file, version, CurrentVersion)
+	return data, nil
+}
+
+// migrateConfigFile returns the content of an older squadron file migrated to the current schema version
+func migrateConfigFile(file string, raw []byte, version string) (map[string]interface{}, error) {
+	migrated, notes, err := migrate(raw, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to migrate %q", file)
+	}
+	logrus.Debugf("migrated squadron file %q from schema version %s to %s, run `squadron migrate` to persist it", file, version, CurrentVersion)
+	for _, note := range notes {
+		logrus.Debugf("%s: %s", file, note)
+	}
+	config, err := conflate.FromData(migrated)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	if err := config.Unmarshal(&data); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal %q", file)
+	}
+	return data, nil
+}
+
+func isYAMLFile(file string) bool {
+	ext := filepath.Ext(file)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+type pathResolver struct {
+	dir      string
+	basePath string
+}
+
+// expand rewrites relative `file` and `git` template function paths to be relative to the base path
+func (r pathResolver) expand(in interface{}) interface{} {
+	switch value := in.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = r.expand(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = r.expand(v)
+		}
+	case string:
+		if strings.Contains(value, "<%") {
+			value = r.rebase(fileFunctionRegex, value)
+			value = r.rebase(gitFunctionRegex, value)
+		}
+		return value
+	}
+	return in
+}
+
+// rebase rewrites the relative path captured by the expression to be relative to the base path
+func (r pathResolver) rebase(expr *regexp.Regexp, value string) string {
+	return expr.ReplaceAllStringFunc(value, func(match string) string {
+		loc := expr.FindStringSubmatchIndex(match)
+		file := match[loc[2]:loc[3]]
+		if file == "" || filepath.IsAbs(file) || strings.Contains(file, "<%") {
+			return match
+		}
+		rel, err := filepath.Rel(r.basePath, filepath.Join(r.dir, file))
+		if err != nil {
+			return match
+		}
+		return match[:loc[2]] + filepath.ToSlash(rel) + match[loc[3]:]
+	})
+}
+
+func (r pathResolver) resolveUnit(unit map[string]interface{}) {
+	switch chart := unit["chart"].(type) {
+	case string:
+		unit["chart"] = r.resolve(chart)
+	case map[string]interface{}:
+		if repository, ok := chart["repository"].(string); ok && strings.HasPrefix(repository, localChartRepositoryPrefix) {
+			chart["repository"] = localChartRepositoryPrefix + r.resolve(strings.TrimPrefix(repository, localChartRepositoryPrefix))
+		}
+	}
+	if helm, ok := unit["helm"].(map[string]interface{}); ok {
+		if files, ok := helm["values_files"].([]interface{}); ok {
+			for i, file := range files {
+				if f, ok := file.(string); ok {
+					files[i] = r.resolve(f)
+				}
+			}
+		}
+		// executables without a path are looked up in the PATH by helm
+		if postRenderer, ok := helm["post_renderer"].(string); ok && strings.ContainsAny(postRenderer, `/\`) {
+			helm["post_renderer"] = r.resolve(postRenderer)
+		}
+	}
+	if builds, ok := unit["builds"].(map[string]interface{}); ok {
+		for name, build := range builds {
+			switch b := build.(type) {
+			case string:
+				builds[name] = r.resolve(b)
+			case map[string]interface{}:
+				// the dockerfile stays relative to the context
+				if context, ok := b["context"].(string); ok {
+					b["context"] = r.resolve(context)
+				}
+			}
+		}
+	}
+}
+
+// resolve replaces `${PWD}` with the declaring file's directory and returns the absolute path for relative paths without templates
+func (r pathResolver) resolve(p string) string {
+	p = pwdRegex.ReplaceAllLiteralString(p, r.dir)
+	if p == "" || strings.Contains(p, "<%") {
+		return p
+	} else if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(r.dir, filepath.FromSlash(p))
+}
+
+// resolveFile returns the absolute path for files relative to the base path
+func resolveFile(basePath, file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(basePath, filepath.FromSlash(file))
+}
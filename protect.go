@@ -0,0 +1,79 @@
+package squadron
+
+import (
+	"path"
+	"sort"
+)
+
+// Release is a helm release managed by the squadron
+type Release struct {
+	Name      string
+	Namespace string
+	Units     []string
+}
+
+// Releases returns the helm releases of the enabled units, a single one in unite mode
+func (sq *Squadron) Releases(units map[string]Unit) []Release {
+	releases := map[string]*Release{}
+	for uName, u := range units {
+		if !u.IsEnabled() {
+			continue
+		}
+		name, namespace := sq.releaseName(uName), sq.unitNamespace(u)
+		key := namespace + "/" + name
+		if _, ok := releases[key]; !ok {
+			releases[key] = &Release{Name: name, Namespace: namespace}
+		}
+		releases[key].Units = append(releases[key].Units, uName)
+	}
+	ret := make([]Release, 0, len(releases))
+	for _, r := range releases {
+		sort.Strings(r.Units)
+		ret = append(ret, *r)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// IsProtected returns true if the squadron or any namespace of the units is protected
+func (sq *Squadron) IsProtected(units map[string]Unit) bool {
+	if sq.c.Protected {
+		return true
+	}
+	for _, namespace := range sq.unitNamespaces(units) {
+		for _, pattern := range sq.c.ProtectedNamespaces {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequiresConfirmation returns true if installing or uninstalling the units needs to be confirmed,
+// installing up to `protected_max_units` units doesn't
+func (sq *Squadron) RequiresConfirmation(units map[string]Unit, uninstall bool) bool {
+	if !sq.IsProtected(units) {
+		return false
+	}
+	if uninstall {
+		return true
+	}
+	var count int
+	for _, u := range units {
+		if u.IsEnabled() {
+			count++
+		}
+	}
+	return count > sq.c.ProtectedMaxUnits
+}
+
+// Name returns the squadron's name
+func (sq *Squadron) Name() string {
+	return sq.name
+}
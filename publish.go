@@ -0,0 +1,114 @@
+package squadron
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/foomo/squadron/util"
+)
+
+const (
+	ociRepositoryPrefix = "oci://"
+	// chartMuseumUploadPath is the ChartMuseum api endpoint to upload charts to
+	chartMuseumUploadPath = "/api/charts"
+	envRepositoryUsername = "HELM_REPO_USERNAME"
+	envRepositoryPassword = "HELM_REPO_PASSWORD"
+)
+
+// ChartVersion returns the version of the umbrella chart which is either configured or the latest git tag
+func (sq *Squadron) ChartVersion() (string, error) {
+	if sq.c.Chart.Version != "" {
+		return sq.c.Chart.Version, nil
+	}
+	tag, err := gitOutput(sq.basePath, "describe", "--tags", "--abbrev=0")
+	if err != nil || tag == "" {
+		return "", errors.New("missing chart version, set chart.version or tag the commit")
+	}
+	return strings.TrimPrefix(tag, "v"), nil
+}
+
+// Package generates the umbrella chart of all enabled units and packages it into a versioned archive within
+// the destination, which defaults to the output directory, and returns the archive's path
+func (sq *Squadron) Package(destination, version string) (string, error) {
+	if version == "" {
+		var err error
+		if version, err = sq.ChartVersion(); err != nil {
+			return "", err
+		}
+	}
+	if destination == "" {
+		destination = path.Join(sq.basePath, defaultOutputDir)
+	}
+	if err := sq.cleanupOutput(sq.chartPath()); err != nil {
+		return "", err
+	}
+	toggles := map[string]bool{}
+	for name := range sq.enabledUnits(sq.c.Units) {
+		toggles[name] = true
+	}
+	if err := sq.generateUmbrellaChart(toggles, version); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return "", err
+	}
+	logrus.Infof("running helm package for chart: %v", sq.chartPath())
+	if out, err := util.NewHelmCommand().Package(sq.name, sq.chartPath(), destination, version); err != nil {
+		return "", errors.Wrap(err, out)
+	}
+	return filepath.Join(destination, fmt.Sprintf("%s-%s.tgz", sq.name, version)), nil
+}
+
+// PublishChart pushes the chart archive to an OCI registry (oci://) or a ChartMuseum compatible
+// http repository using the HELM_REPO_USERNAME and HELM_REPO_PASSWORD env variables for basic auth
+func PublishChart(file, repository string) error {
+	switch {
+	case repository == "":
+		return errors.New("missing chart repository")
+	case strings.HasPrefix(repository, ociRepositoryPrefix):
+		logrus.Infof("pushing chart %q to %s", file, repository)
+		if out, err := util.NewHelmCommand().Push(file, repository); err != nil {
+			return errors.Wrap(err, out)
+		}
+		return nil
+	case strings.HasPrefix(repository, "http://"), strings.HasPrefix(repository, "https://"):
+		logrus.Infof("uploading chart %q to %s", file, repository)
+		return uploadChart(file, repository, os.Getenv(envRepositoryUsername), os.Getenv(envRepositoryPassword))
+	default:
+		return errors.Errorf("unsupported chart repository %q, expected oci:// or http(s)://", repository)
+	}
+}
+
+func uploadChart(file, repository, username, password string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(repository, "/")+chartMuseumUploadPath, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to upload chart")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("failed to upload chart: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package squadron
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	dockerfile    = "Dockerfile"
+	gitignoreFile = ".gitignore"
+)
+
+// scaffoldSkipDirs are not searched for units
+var scaffoldSkipDirs = map[string]bool{
+	".git":           true,
+	defaultOutputDir: true,
+	"node_modules":   true,
+	"vendor":         true,
+}
+
+// ScaffoldUnit is a unit detected in the directory tree, paths are relative to the squadron directory
+type ScaffoldUnit struct {
+	Name       string
+	Chart      string
+	Context    string
+	Dockerfile string
+}
+
+// DetectUnits searches the directory tree for Dockerfiles and local charts and groups them into units by name
+func DetectUnits(dir string) ([]ScaffoldUnit, error) {
+	units := map[string]*ScaffoldUnit{}
+	unit := func(name string) *ScaffoldUnit {
+		if _, ok := units[name]; !ok {
+			units[name] = &ScaffoldUnit{Name: name}
+		}
+		return units[name]
+	}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if scaffoldSkipDirs[info.Name()] && file != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case info.Name() == chartFile:
+			c, err := loadChart(file)
+			if err != nil {
+				return err
+			}
+			name := c.Name
+			if name == "" {
+				name = scaffoldUnitName(dir, rel)
+			}
+			if u := unit(name); u.Chart == "" {
+				u.Chart = "./" + rel
+			}
+			// don't treat files of a chart as units
+			return filepath.SkipDir
+		case info.Name() == dockerfile || strings.HasSuffix(info.Name(), "."+dockerfile):
+			if u := unit(scaffoldUnitName(dir, rel)); u.Context == "" {
+				u.Context = "./" + rel
+				if info.Name() != dockerfile {
+					u.Dockerfile = info.Name()
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]ScaffoldUnit, 0, len(units))
+	for _, u := range units {
+		ret = append(ret, *u)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// scaffoldUnitName returns the directory name or the parent's if the directory is named after its contents
+func scaffoldUnitName(dir, rel string) string {
+	if rel == "." {
+		return filepath.Base(dir)
+	}
+	name := path.Base(rel)
+	switch name {
+	case "chart", "charts", "helm", "docker", "build":
+		if parent := path.Dir(rel); parent != "." {
+			return path.Base(parent)
+		}
+		return filepath.Base(dir)
+	}
+	return name
+}
+
+type scaffoldConfig struct {
+	Version string                        `yaml:"version"`
+	Name    string                        `yaml:"name,omitempty"`
+	Units   map[string]scaffoldUnitConfig `yaml:"squadron,omitempty"`
+}
+
+type scaffoldUnitConfig struct {
+	Chart  interface{}            `yaml:"chart,omitempty"`
+	Builds map[string]Build       `yaml:"builds,omitempty"`
+	Values map[string]interface{} `yaml:"values,omitempty"`
+}
+
+// Scaffold returns the squadron file content for the given units
+func Scaffold(name, registry string, units []ScaffoldUnit) ([]byte, error) {
+	c := scaffoldConfig{
+		Version: CurrentVersion,
+		Name:    name,
+		Units:   map[string]scaffoldUnitConfig{},
+	}
+	for _, u := range units {
+		uc := scaffoldUnitConfig{}
+		if u.Chart != "" {
+			uc.Chart = u.Chart
+		}
+		if u.Context != "" {
+			image := u.Name
+			if registry != "" {
+				image = strings.TrimSuffix(registry, "/") + "/" + image
+			}
+			uc.Builds = map[string]Build{
+				"default": {
+					Image:      image,
+					Tag:        "latest",
+					Context:    u.Context,
+					Dockerfile: u.Dockerfile,
+				},
+			}
+			uc.Values = map[string]interface{}{
+				"image": map[string]interface{}{
+					"repository": "<% .Unit.builds.default.image %>",
+					"tag":        "<% .Unit.builds.default.tag %>",
+				},
+			}
+		}
+		c.Units[u.Name] = uc
+	}
+	out := bytes.NewBuffer([]byte{})
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// AddGitignore appends the squadron output directory to the .gitignore file in dir unless it is already ignored
+func AddGitignore(dir string) (bool, error) {
+	file := filepath.Join(dir, gitignoreFile)
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		switch strings.TrimSpace(line) {
+		case defaultOutputDir, defaultOutputDir + "/", "/" + defaultOutputDir, "/" + defaultOutputDir + "/":
+			return false, nil
+		}
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = append(data, []byte(defaultOutputDir+"/\n")...)
+	return true, ioutil.WriteFile(file, data, 0644) //nolint:gosec
+}
@@ -0,0 +1,96 @@
+package squadron
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UnitSelector selects units by name and tags, patterns may contain globs and are negated by a leading `!`
+type UnitSelector struct {
+	// Names selects units matching any of the patterns, all units if there are only exclusions
+	Names []string
+	// Tags must all be matched by a unit's tags, `key!=value` is short for `!key=value`
+	Tags []string
+}
+
+// Empty returns true if the selector selects all units
+func (s UnitSelector) Empty() bool {
+	return len(s.Names) == 0 && len(s.Tags) == 0
+}
+
+// Select returns the selected units and fails on name patterns without any matching unit
+func (s UnitSelector) Select(units map[string]Unit) (map[string]Unit, error) {
+	var includes, excludes []string
+	for _, name := range s.Names {
+		if strings.HasPrefix(name, "!") {
+			excludes = append(excludes, strings.TrimPrefix(name, "!"))
+		} else {
+			includes = append(includes, name)
+		}
+	}
+	for _, pattern := range append(includes, excludes...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid unit pattern %q", pattern)
+		}
+	}
+	for _, pattern := range includes {
+		var matched bool
+		for name := range units {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, errors.Errorf("unknown unit name %s", pattern)
+		}
+	}
+	ret := map[string]Unit{}
+	for name, unit := range units {
+		if len(includes) > 0 && !matchAny(includes, name) {
+			continue
+		}
+		if matchAny(excludes, name) {
+			continue
+		}
+		if !s.matchTags(unit.Tags) {
+			continue
+		}
+		ret[name] = unit
+	}
+	return ret, nil
+}
+
+func (s UnitSelector) matchTags(tags []string) bool {
+	for _, tag := range s.Tags {
+		negate := strings.HasPrefix(tag, "!")
+		tag = strings.TrimPrefix(tag, "!")
+		if i := strings.Index(tag, "!="); i > 0 {
+			negate = !negate
+			tag = tag[:i] + "=" + tag[i+2:]
+		}
+		var matched bool
+		for _, t := range tags {
+			if matchAny([]string{tag}, t) {
+				matched = true
+				break
+			}
+		}
+		if matched == negate {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns true if any of the glob patterns matches the value
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -2,12 +2,16 @@ package squadron
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/miracl/conflate"
 	"github.com/pkg/errors"
@@ -23,16 +27,34 @@ const (
 	chartAPIVersionV2 = "v2"
 	defaultChartType  = "application" // application or library
 	chartFile         = "Chart.yaml"
+	chartTemplatesDir = "templates"
 	valuesFile        = "values.yaml"
+	secretCacheFile   = "secrets.cache"
+	maxRenderPasses   = 10
 )
 
+// defaultChartVersion is used for umbrella charts without configured version or git tag
+const defaultChartVersion = "0.1.0"
+
 type Configuration struct {
-	Name    string                 `yaml:"name,omitempty"`
-	Version string                 `yaml:"version,omitempty"`
-	Prefix  string                 `yaml:"prefix,omitempty"`
-	Unite   bool                   `yaml:"unite,omitempty"`
-	Global  map[string]interface{} `yaml:"global,omitempty"`
-	Units   map[string]Unit        `yaml:"squadron,omitempty"`
+	Name    string `yaml:"name,omitempty"`
+	Version string `yaml:"version,omitempty"`
+	Prefix  string `yaml:"prefix,omitempty"`
+	Unite   bool   `yaml:"unite,omitempty"`
+	// EnvFiles are loaded before rendering the templates
+	EnvFiles []string               `yaml:"env_files,omitempty"`
+	Global   map[string]interface{} `yaml:"global,omitempty"`
+	// Chart configures the generated umbrella chart
+	Chart ChartMetadata `yaml:"chart,omitempty"`
+	// KubeContexts lists the allowed kube context or cluster names by namespace, both may be globs
+	KubeContexts map[string][]string `yaml:"kube_contexts,omitempty"`
+	// Protected requires confirmations i.e. when set in a profile
+	Protected bool `yaml:"protected,omitempty"`
+	// ProtectedNamespaces require confirmations, may be globs
+	ProtectedNamespaces []string `yaml:"protected_namespaces,omitempty"`
+	// ProtectedMaxUnits is the number of units which can be installed without confirmation
+	ProtectedMaxUnits int             `yaml:"protected_max_units,omitempty"`
+	Units             map[string]Unit `yaml:"squadron,omitempty"`
 }
 
 type Squadron struct {
@@ -42,6 +64,17 @@ type Squadron struct {
 	files     []string
 	config    string
 	c         Configuration
+	cache     *cache
+	envFiles  []string
+	profile   string
+	vars      map[string]string
+	global    map[string]interface{}
+	// env holds the variables of the env files which don't override existing ones
+	env map[string]string
+	// sources are the declaring positions of the config keys
+	sources sourceMap
+	// kubeContext is passed to helm and kubectl unless empty
+	kubeContext string
 }
 
 func New(basePath, namespace string, files []string) *Squadron {
@@ -51,9 +84,41 @@ func New(basePath, namespace string, files []string) *Squadron {
 		namespace: namespace,
 		files:     files,
 		c:         Configuration{},
+		cache:     newCache(),
+		vars:      map[string]string{},
 	}
 }
 
+// SetProfile sets the profile exposed to the templates as `.Profile`
+func (sq *Squadron) SetProfile(profile string) {
+	sq.profile = profile
+}
+
+// SetVar sets a variable exposed to the templates as `.Vars.<name>`
+func (sq *Squadron) SetVar(name, value string) {
+	sq.vars[name] = value
+}
+
+// InheritGlobal sets global values i.e. from a workspace which can be overridden by the squadron files
+func (sq *Squadron) InheritGlobal(global map[string]interface{}) {
+	sq.global = global
+}
+
+// AddEnvFiles adds env files to be loaded in addition to the configured ones, relative to the working directory
+func (sq *Squadron) AddEnvFiles(files ...string) {
+	sq.envFiles = append(sq.envFiles, files...)
+}
+
+// SetKubeContext sets the kube context used by all helm and kubectl calls
+func (sq *Squadron) SetKubeContext(context string) {
+	sq.kubeContext = context
+}
+
+// SetSecretCache enables the encrypted on-disk cache for secrets fetched while rendering
+func (sq *Squadron) SetSecretCache(ttl time.Duration, passphrase string) {
+	sq.cache.store = newSecretStore(path.Join(sq.basePath, defaultOutputDir, secretCacheFile), ttl, passphrase)
+}
+
 func (sq *Squadron) GetConfig() Configuration {
 	return sq.c
 }
@@ -62,8 +127,47 @@ func (sq *Squadron) GetConfigYAML() string {
 	return sq.config
 }
 
+func (sq *Squadron) GetConfigJSON() (string, error) {
+	config, err := conflate.FromData([]byte(sq.config))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to conflate config")
+	}
+	out, err := config.MarshalJSON()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal json")
+	}
+	return string(out), nil
+}
+
+func (sq *Squadron) GetConfigTOML() (string, error) {
+	config, err := conflate.FromData([]byte(sq.config))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to conflate config")
+	}
+	out, err := config.MarshalTOML()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal toml")
+	}
+	return string(out), nil
+}
+
 func (sq *Squadron) MergeConfigFiles() error {
-	mergedFiles, err := conflate.FromFiles(sq.files...)
+	var objs []interface{}
+	if len(sq.global) > 0 {
+		objs = append(objs, map[string]interface{}{"global": sq.global})
+	}
+	sq.sources = sourceMap{}
+	for _, file := range sq.files {
+		obj, err := loadConfigFile(file, sq.basePath)
+		if err != nil {
+			return errors.Wrap(err, "failed to load file")
+		}
+		objs = append(objs, obj)
+		if data, err := ioutil.ReadFile(file); err == nil {
+			sq.sources.add(file, data)
+		}
+	}
+	mergedFiles, err := conflate.FromGo(objs...)
 	if err != nil {
 		return errors.Wrap(err, "failed to conflate files")
 	}
@@ -79,32 +183,89 @@ func (sq *Squadron) MergeConfigFiles() error {
 		return err
 	}
 	sq.config = string(fileBytes)
+	if sq.c.Name != "" {
+		sq.name = sq.c.Name
+	}
 	return nil
 }
 
-func (sq *Squadron) RenderConfig() error {
-	tv := TemplateVars{}
-	// execute without errors to get existing values
-	out, err := executeFileTemplate(sq.config, tv, false)
+// Override applies helm style `--set`, `--set-string` and `--set-file` values on top of the merged config files
+func (sq *Squadron) Override(values, stringValues, fileValues []string) error {
+	if len(values) == 0 && len(stringValues) == 0 && len(fileValues) == 0 {
+		return nil
+	}
+	data := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(sq.config), &data); err != nil {
+		return err
+	}
+	if err := applyOverrides(data, values, overrideTypeTyped); err != nil {
+		return err
+	}
+	if err := applyOverrides(data, stringValues, overrideTypeString); err != nil {
+		return err
+	}
+	if err := applyOverrides(data, fileValues, overrideTypeFile); err != nil {
+		return err
+	}
+	overrides, err := conflate.FromGo(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to conflate overrides")
+	}
+	fileBytes, err := overrides.MarshalYAML()
 	if err != nil {
-		return errors.Wrap(err, "failed to execute initial file template")
+		return errors.Wrap(err, "failed to marshal yaml")
 	}
-	var vars map[string]interface{}
-	if err := yaml.Unmarshal(out, &vars); err != nil {
+	sq.c = Configuration{}
+	if err := yaml.Unmarshal(fileBytes, &sq.c); err != nil {
 		return err
 	}
-	// execute again with loaded template vars
-	if value, ok := vars["global"]; ok {
-		replace(value)
-		tv.add("Global", value)
+	sq.config = string(fileBytes)
+	if sq.c.Name != "" {
+		sq.name = sq.c.Name
 	}
-	if value, ok := vars["squadron"]; ok {
-		replace(value)
-		tv.add("Squadron", value)
+	return nil
+}
+
+func (sq *Squadron) RenderConfig() error {
+	if err := sq.loadEnvFiles(); err != nil {
+		return err
 	}
-	out, err = executeFileTemplate(sq.config, tv, true)
+	if sq.cache.store != nil {
+		if err := sq.cache.store.load(); err != nil {
+			return err
+		}
+	}
+	// seed the template vars with the raw values so functions don't receive empty values
+	tv, err := sq.templateVars([]byte(sq.config))
 	if err != nil {
-		return errors.Wrap(err, "failed to execute second file template")
+		return err
+	}
+	// execute without errors until the values don't change anymore
+	seen := map[string]bool{}
+	for i := 0; ; i++ {
+		if i == maxRenderPasses {
+			return errors.Errorf("failed to render config within %d passes", maxRenderPasses)
+		}
+		out, err := sq.executeTemplate(tv, false)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute file template")
+		}
+		if seen[string(out)] {
+			// the output is either stable or oscillates between states
+			if paths := templatePaths(out); len(paths) > 0 {
+				return errors.Errorf("failed to render config due to cyclic references in: %s", strings.Join(paths, ", "))
+			}
+			break
+		}
+		seen[string(out)] = true
+		if tv, err = sq.templateVars(out); err != nil {
+			return err
+		}
+	}
+	// execute again with the resolved template vars
+	out, err := sq.executeTemplate(tv, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute file template")
 	}
 	if err := yaml.Unmarshal(out, &sq.c); err != nil {
 		return err
@@ -115,6 +276,90 @@ func (sq *Squadron) RenderConfig() error {
 		sq.name = sq.c.Name
 	}
 
+	if secrets := sq.cache.fetchedSecrets(); len(secrets) > 0 {
+		logrus.Debugf("fetched secrets: %s", strings.Join(secrets, ", "))
+	}
+	if sq.cache.store != nil {
+		if err := sq.cache.store.save(); err != nil {
+			return errors.Wrap(err, "failed to save secret cache")
+		}
+	}
+
+	return nil
+}
+
+// templateVars returns the config values along with the runtime information
+func (sq *Squadron) templateVars(config []byte) (TemplateVars, error) {
+	tv, err := newTemplateVars(config)
+	if err != nil {
+		return nil, err
+	}
+	units, ok := tv["Squadron"].(map[string]interface{})
+	if !ok {
+		units = map[string]interface{}{}
+		tv.add("Squadron", units)
+	}
+	// a unit named `Name` takes precedence over the squadron name
+	if _, ok := units["Name"]; ok {
+		logrus.Warn("unit `Name` shadows the squadron name in .Squadron.Name")
+	} else {
+		units["Name"] = sq.name
+	}
+	tv.add("Namespace", sq.namespace)
+	tv.add("Profile", sq.profile)
+	tv.add("Release", sq.name)
+	tv.add("Cwd", sq.basePath)
+	tv.add("Vars", sq.vars)
+	return tv, nil
+}
+
+// executeTemplate renders the config separately for each unit so that `.Unit` and `.Release` refer to it
+func (sq *Squadron) executeTemplate(tv TemplateVars, errorOnMissing bool) ([]byte, error) {
+	units, _ := tv["Units"].(map[string]interface{})
+	var ret []string
+	for _, chunk := range splitUnitTemplates(sq.config) {
+		vars := tv
+		if chunk.unit != "" {
+			vars = TemplateVars{}
+			for k, v := range tv {
+				vars.add(k, v)
+			}
+			unit := map[string]interface{}{}
+			if value, ok := units[chunk.unit].(map[string]interface{}); ok {
+				for k, v := range value {
+					unit[k] = v
+				}
+			}
+			unit["Name"] = chunk.unit
+			vars.add("Unit", unit)
+			vars.add("Release", sq.releaseName(chunk.unit))
+		}
+		out, err := executeFileTemplate(chunk.text, vars, errorOnMissing, sq.cache, sq.basePath, sq.env)
+		if err != nil {
+			return nil, newTemplateError(err, chunk, sq.config, sq.sources, vars)
+		}
+		ret = append(ret, string(out))
+	}
+	return []byte(strings.Join(ret, "\n")), nil
+}
+
+// loadEnvFiles reads the env files into the variables of this squadron only, so that
+// squadrons of a workspace don't see each other's values
+func (sq *Squadron) loadEnvFiles() error {
+	sq.env = map[string]string{}
+	// explicitly added files take precedence, configured files have been resolved against their declaring file
+	for _, file := range append(sq.envFiles, sq.c.EnvFiles...) {
+		logrus.Debugf("loading env file %q", file)
+		vars, err := util.ReadEnvFile(file)
+		if err != nil {
+			return err
+		}
+		for name, value := range vars {
+			if _, ok := sq.env[name]; !ok {
+				sq.env[name] = value
+			}
+		}
+	}
 	return nil
 }
 
@@ -123,8 +368,13 @@ func (sq *Squadron) Generate(units map[string]Unit) error {
 	if err := sq.cleanupOutput(sq.chartPath()); err != nil {
 		return err
 	}
+	units = sq.enabledUnits(units)
 	if sq.c.Unite {
-		return sq.generateUmbrellaChart(units)
+		toggles, err := sq.uniteToggles(units, true)
+		if err != nil {
+			return err
+		}
+		return sq.generateUmbrellaChart(toggles, "")
 	}
 	for uName, u := range units {
 		logrus.Infof("generating %q value overrides file in %q", uName, sq.chartPath())
@@ -135,9 +385,79 @@ func (sq *Squadron) Generate(units map[string]Unit) error {
 	return nil
 }
 
-func (sq *Squadron) generateUmbrellaChart(units map[string]Unit) error {
+// uniteToggles returns whether each unit is enabled within the umbrella chart, the selected units are
+// set to enable while the others keep their deployed state so that partial operations don't affect them
+func (sq *Squadron) uniteToggles(selected map[string]Unit, enable bool) (map[string]bool, error) {
+	units := sq.enabledUnits(sq.c.Units)
+	var partial bool
+	for name := range units {
+		if _, ok := selected[name]; !ok {
+			partial = true
+			break
+		}
+	}
+	deployed := map[string]bool{}
+	if partial {
+		var err error
+		if deployed, err = sq.deployedUnits(); err != nil {
+			return nil, err
+		}
+	}
+	ret := make(map[string]bool, len(units))
+	for name := range units {
+		if _, ok := selected[name]; ok {
+			ret[name] = enable
+		} else {
+			ret[name] = deployed[name]
+		}
+	}
+	return ret, nil
+}
+
+// deployedUnits returns the units enabled in the deployed umbrella chart release
+func (sq *Squadron) deployedUnits() (map[string]bool, error) {
+	stdErr := bytes.NewBuffer([]byte{})
+	out, err := sq.helmCmd().Args("get", "values", sq.name, "--all", "--output", "json").
+		Args("--namespace", sq.namespace).
+		Stderr(stdErr).
+		Run()
+	if err != nil {
+		if strings.Contains(stdErr.String(), "release: not found") {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(out), &values); err != nil {
+		return nil, errors.Wrap(err, "failed to parse deployed values")
+	}
+	ret := map[string]bool{}
+	for name := range sq.c.Units {
+		if v, ok := values[name].(map[string]interface{}); ok {
+			// releases installed before the toggles were introduced deployed all of their units
+			enabled, ok := v["enabled"].(bool)
+			ret[name] = enabled || !ok
+		}
+	}
+	return ret, nil
+}
+
+// generateUmbrellaChart generates the umbrella chart using the given or the resolved chart version
+func (sq *Squadron) generateUmbrellaChart(toggles map[string]bool, version string) error {
+	if version == "" {
+		var err error
+		if version, err = sq.ChartVersion(); err != nil {
+			logrus.Debugf("using chart version %s: %s", defaultChartVersion, err)
+			version = defaultChartVersion
+		}
+	}
+	for name, enabled := range toggles {
+		if u := sq.c.Units[name]; enabled && !u.Helm.empty() {
+			logrus.Warnf("ignoring helm options of unit %s in unite mode", name)
+		}
+	}
 	logrus.Infof("generating chart %q files in %q", sq.name, sq.chartPath())
-	if err := sq.generateChart(units, sq.chartPath(), sq.name, sq.c.Version); err != nil {
+	if err := sq.generateChart(toggles, sq.chartPath(), sq.name, version); err != nil {
 		return err
 	}
 	logrus.Infof("running helm dependency update for chart: %v", sq.chartPath())
@@ -145,31 +465,35 @@ func (sq *Squadron) generateUmbrellaChart(units map[string]Unit) error {
 	return err
 }
 
-func (sq *Squadron) Package() error {
-	logrus.Infof("running helm package for chart: %v", sq.chartPath())
-	_, err := util.NewHelmCommand().Package(sq.name, sq.chartPath(), sq.basePath)
-	return err
-}
-
 func (sq *Squadron) Down(units map[string]Unit, helmArgs []string) error {
 	if sq.c.Unite {
+		toggles, err := sq.uniteToggles(sq.enabledUnits(units), false)
+		if err != nil {
+			return err
+		}
+		for _, enabled := range toggles {
+			if enabled {
+				// disable the given units only
+				return sq.upgradeUmbrellaChart(toggles, helmArgs)
+			}
+		}
 		logrus.Infof("running helm uninstall for: %s", sq.chartPath())
-		_, err := util.NewHelmCommand().Args("uninstall", sq.name).
+		_, err = sq.helmCmd().Args("uninstall", sq.name).
 			Stdout(os.Stdout).
 			Args("--namespace", sq.namespace).
 			Args(helmArgs...).
 			Run()
 		return err
 	}
-	for uName := range units {
-		// todo use release prefix on install: squadron name or --name
-		rName := fmt.Sprintf("%s-%s", sq.name, uName)
+	for uName, u := range units {
+		rName := sq.releaseName(uName)
 		logrus.Infof("running helm uninstall for: %s", uName)
 		stdErr := bytes.NewBuffer([]byte{})
-		if _, err := util.NewHelmCommand().Args("uninstall", rName).
+		if _, err := sq.helmCmd().Args("uninstall", rName).
 			Stderr(stdErr).
 			Stdout(os.Stdout).
-			Args("--namespace", sq.namespace).
+			Args("--namespace", sq.unitNamespace(u)).
+			Args(u.Helm.uninstallArgs()...).
 			Args(helmArgs...).
 			Run(); err != nil &&
 			string(bytes.TrimSpace(stdErr.Bytes())) != fmt.Sprintf("Error: uninstall: Release not loaded: %s: release: not found", uName) {
@@ -180,14 +504,33 @@ func (sq *Squadron) Down(units map[string]Unit, helmArgs []string) error {
 	return nil
 }
 
+// upgradeUmbrellaChart regenerates the umbrella chart with the given toggles and upgrades the release
+func (sq *Squadron) upgradeUmbrellaChart(toggles map[string]bool, helmArgs []string) error {
+	if err := sq.cleanupOutput(sq.chartPath()); err != nil {
+		return err
+	}
+	if err := sq.generateUmbrellaChart(toggles, ""); err != nil {
+		return err
+	}
+	logrus.Infof("running helm upgrade for chart: %s", sq.chartPath())
+	_, err := sq.helmCmd().
+		Stdout(os.Stdout).
+		Args("upgrade", sq.name, sq.chartPath()).
+		Args("--namespace", sq.namespace).
+		Args(helmArgs...).
+		Run()
+	return err
+}
+
 func (sq *Squadron) Diff(units map[string]Unit, helmArgs []string) (string, error) {
+	units = sq.enabledUnits(units)
 	if sq.c.Unite {
 		logrus.Infof("running helm diff for: %s", sq.chartPath())
-		manifest, err := exec.Command("helm", "get", "manifest", sq.name, "--namespace", sq.namespace).Output() //nolint:gosec
+		manifest, err := exec.Command("helm", sq.helmArgs("get", "manifest", sq.name, "--namespace", sq.namespace)...).Output() //nolint:gosec
 		if err != nil {
 			return "", err
 		}
-		template, err := exec.Command("helm", "upgrade", sq.name, sq.chartPath(), "--namespace", sq.namespace, "--dry-run").Output() //nolint:gosec
+		template, err := exec.Command("helm", sq.helmArgs("upgrade", sq.name, sq.chartPath(), "--namespace", sq.namespace, "--dry-run")...).Output() //nolint:gosec
 		if err != nil {
 			return "", err
 		}
@@ -195,14 +538,16 @@ func (sq *Squadron) Diff(units map[string]Unit, helmArgs []string) (string, erro
 		return dmp.DiffPrettyText(dmp.DiffMain(string(manifest), string(template), false)), nil
 	}
 	for uName, u := range units {
-		// todo use release prefix on install: squadron name or --name
-		rName := fmt.Sprintf("%s-%s", sq.name, uName)
+		rName := sq.releaseName(uName)
 		logrus.Infof("running helm diff for: %s", uName)
-		manifest, err := exec.Command("helm", "get", "manifest", rName, "--namespace", sq.namespace).CombinedOutput()
+		manifest, err := exec.Command("helm", sq.helmArgs("get", "manifest", rName, "--namespace", sq.unitNamespace(u))...).CombinedOutput() //nolint:gosec
 		if err != nil && string(bytes.TrimSpace(manifest)) != "Error: release: not found" {
 			return "", err
 		}
-		cmd := exec.Command("helm", "upgrade", rName, "--install", "--namespace", sq.namespace, "-f", path.Join(sq.chartPath(), uName+".yaml"), "--dry-run")
+		cmd := exec.Command("helm", sq.helmArgs("upgrade", rName, "--install", "--namespace", sq.unitNamespace(u), "--dry-run")...) //nolint:gosec
+		cmd.Args = append(cmd.Args, u.Helm.valuesArgs()...)
+		cmd.Args = append(cmd.Args, "-f", path.Join(sq.chartPath(), uName+".yaml"))
+		cmd.Args = append(cmd.Args, u.Helm.renderArgs()...)
 		if strings.Contains(u.Chart.Repository, "file://") {
 			cmd.Args = append(cmd.Args, "/"+strings.TrimPrefix(u.Chart.Repository, "file://"))
 		} else {
@@ -220,9 +565,10 @@ func (sq *Squadron) Diff(units map[string]Unit, helmArgs []string) (string, erro
 }
 
 func (sq *Squadron) Up(units map[string]Unit, helmArgs []string) error {
+	units = sq.enabledUnits(units)
 	if sq.c.Unite {
 		logrus.Infof("running helm upgrade for chart: %s", sq.chartPath())
-		_, err := util.NewHelmCommand().
+		_, err := sq.helmCmd().
 			Stdout(os.Stdout).
 			Args("upgrade", sq.name, sq.chartPath(), "--install").
 			Args("--namespace", sq.namespace).
@@ -231,15 +577,14 @@ func (sq *Squadron) Up(units map[string]Unit, helmArgs []string) error {
 		return err
 	}
 	for uName, u := range units {
-		// todo use release prefix on install: squadron name or --name
-		rName := fmt.Sprintf("%s-%s", sq.name, uName)
+		rName := sq.releaseName(uName)
 		logrus.Infof(
 			"running helm dependency update for %s in %s",
 			uName,
 			strings.TrimPrefix(u.Chart.Repository, "file://"),
 		)
 		if strings.Contains(u.Chart.Repository, "file://") {
-			if _, err := util.NewHelmCommand().
+			if _, err := sq.helmCmd().
 				Args("dependency", "update").
 				Cwd(strings.TrimPrefix(u.Chart.Repository, "file://")).
 				Stdout(os.Stdout).
@@ -248,11 +593,13 @@ func (sq *Squadron) Up(units map[string]Unit, helmArgs []string) error {
 			}
 		}
 		logrus.Infof("running helm upgrade for %s", uName)
-		cmd := util.NewHelmCommand().
+		cmd := sq.helmCmd().
 			Stdout(os.Stdout).
 			Args("upgrade", rName, "--install").
-			Args("--namespace", sq.namespace).
+			Args("--namespace", sq.unitNamespace(u)).
+			Args(u.Helm.valuesArgs()...).
 			Args("-f", path.Join(sq.chartPath(), uName+".yaml")).
+			Args(u.Helm.upgradeArgs()...).
 			Args(helmArgs...)
 		if strings.Contains(u.Chart.Repository, "file://") {
 			cmd.Args(strings.TrimPrefix(u.Chart.Repository, "file://"))
@@ -267,9 +614,10 @@ func (sq *Squadron) Up(units map[string]Unit, helmArgs []string) error {
 }
 
 func (sq *Squadron) Template(units map[string]Unit, helmArgs []string) error {
+	units = sq.enabledUnits(units)
 	if sq.c.Unite {
 		logrus.Infof("running helm template for chart: %s", sq.chartPath())
-		_, err := util.NewHelmCommand().Args("template", sq.name, sq.chartPath()).
+		_, err := sq.helmCmd().Args("template", sq.name, sq.chartPath()).
 			Stdout(os.Stdout).
 			Args("--namespace", sq.namespace).
 			Args(helmArgs...).
@@ -277,13 +625,14 @@ func (sq *Squadron) Template(units map[string]Unit, helmArgs []string) error {
 		return err
 	}
 	for uName, u := range units {
-		// todo use release prefix on install: squadron name or --name
-		rName := fmt.Sprintf("%s-%s", sq.name, uName)
+		rName := sq.releaseName(uName)
 		logrus.Infof("running helm template for chart: %s", uName)
-		cmd := util.NewHelmCommand().Args("template", rName).
+		cmd := sq.helmCmd().Args("template", rName).
 			Stdout(os.Stdout).
-			Args("--namespace", sq.namespace).
+			Args("--namespace", sq.unitNamespace(u)).
+			Args(u.Helm.valuesArgs()...).
 			Args("-f", path.Join(sq.chartPath(), uName+".yaml")).
+			Args(u.Helm.renderArgs()...).
 			Args(helmArgs...)
 		if strings.Contains(u.Chart.Repository, "file://") {
 			cmd.Args("/" + strings.TrimPrefix(u.Chart.Repository, "file://"))
@@ -297,6 +646,87 @@ func (sq *Squadron) Template(units map[string]Unit, helmArgs []string) error {
 	return nil
 }
 
+// helmCmd returns a helm command using the kube context
+func (sq *Squadron) helmCmd() *util.HelmCmd {
+	cmd := util.NewHelmCommand()
+	if sq.kubeContext != "" {
+		cmd.Args("--kube-context", sq.kubeContext)
+	}
+	return cmd
+}
+
+// helmArgs returns the args along with the kube context
+func (sq *Squadron) helmArgs(args ...string) []string {
+	if sq.kubeContext != "" {
+		return append([]string{"--kube-context", sq.kubeContext}, args...)
+	}
+	return args
+}
+
+// kubeCmd returns a kubectl command using the kube context
+func (sq *Squadron) kubeCmd() *util.KubeCmd {
+	cmd := util.NewKubeCommand()
+	if sq.kubeContext != "" {
+		cmd.Args("--context", sq.kubeContext)
+	}
+	return cmd
+}
+
+// unitNamespace returns the namespace of the unit's release
+func (sq *Squadron) unitNamespace(u Unit) string {
+	if u.Namespace != "" && !sq.c.Unite {
+		return u.Namespace
+	}
+	return sq.namespace
+}
+
+// CreateNamespaces creates the missing namespaces of the given units
+func (sq *Squadron) CreateNamespaces(units map[string]Unit) error {
+	namespaces := map[string]bool{}
+	for uName, u := range sq.enabledUnits(units) {
+		if sq.c.Unite && u.Namespace != "" && u.Namespace != sq.namespace {
+			logrus.Warnf("ignoring namespace %q of unit %s in unite mode", u.Namespace, uName)
+		}
+		namespaces[sq.unitNamespace(u)] = true
+	}
+	existing, err := sq.kubeCmd().GetNamespaces()
+	if err != nil {
+		return err
+	}
+	for _, namespace := range existing {
+		delete(namespaces, namespace)
+	}
+	for namespace := range namespaces {
+		logrus.Infof("creating namespace %s", namespace)
+		if _, err := sq.kubeCmd().CreateNamespace(namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enabledUnits returns the units without the disabled ones
+func (sq *Squadron) enabledUnits(units map[string]Unit) map[string]Unit {
+	ret := make(map[string]Unit, len(units))
+	for name, unit := range units {
+		if !unit.IsEnabled() {
+			logrus.Infof("skipping disabled unit %s", name)
+			continue
+		}
+		ret[name] = unit
+	}
+	return ret
+}
+
+// releaseName returns the helm release name used for the unit
+func (sq *Squadron) releaseName(unit string) string {
+	if sq.c.Unite {
+		return sq.name
+	}
+	// todo use release prefix on install: squadron name or --name
+	return fmt.Sprintf("%s-%s", sq.name, unit)
+}
+
 func (sq *Squadron) chartPath() string {
 	return path.Join(sq.basePath, defaultOutputDir, sq.name)
 }
@@ -315,19 +745,34 @@ func (sq *Squadron) cleanupOutput(chartPath string) error {
 	return nil
 }
 
-func (sq *Squadron) generateChart(units map[string]Unit, chartPath, chartName, version string) error {
+func (sq *Squadron) generateChart(toggles map[string]bool, chartPath, chartName, version string) error {
 	chart := newChart(chartName, version)
+	chart.applyMetadata(sq.c.Chart)
 	values := map[string]interface{}{}
 	if sq.c.Global != nil {
 		values["global"] = sq.c.Global
 	}
-	for name, unit := range units {
+	names := make([]string, 0, len(toggles))
+	for name := range toggles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		unit, enabled := sq.c.Units[name], toggles[name]
 		chart.addDependency(name, unit.Chart)
-		values[name] = unit.Values
+		unitValues := make(map[string]interface{}, len(unit.Values)+1)
+		for k, v := range unit.Values {
+			unitValues[k] = v
+		}
+		unitValues["enabled"] = enabled
+		values[name] = unitValues
 	}
 	if err := chart.generate(chartPath, values); err != nil {
 		return err
 	}
+	if err := copyTemplates(chartPath, sq.c.Chart.Templates); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1,8 +1,21 @@
 package squadron_test
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
 	"path"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 
 	"github.com/foomo/squadron"
 	testutils "github.com/foomo/squadron/tests/utils"
@@ -51,6 +64,128 @@ func TestConfigTemplateSnapshot(t *testing.T) {
 	)
 }
 
+func TestConfigSprigSnapshot(t *testing.T) {
+	testConfigSnapshot(t,
+		[]string{
+			path.Join("testdata", "config-sprig", "squadron.yaml"),
+		},
+		path.Join("testdata", "config-sprig", "squadron.yaml.snapshot"),
+		true,
+	)
+}
+
+func TestConfigEnv(t *testing.T) {
+	var cwd, dir string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+	testutils.Must(t, util.ValidatePath(path.Join("testdata", "config-env"), &dir))
+
+	sq := squadron.New(cwd, "", []string{path.Join("testdata", "config-env", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+
+	// env files are resolved against the declaring file, not the base path
+	assert.Equal(t, []string{path.Join(dir, ".env")}, sq.GetConfig().EnvFiles)
+	assert.Equal(t, map[string]interface{}{
+		"tag":      "1.0.0",
+		"host":     "mycompany.com",
+		"replicas": 1,
+	}, sq.GetConfig().Units["frontend"].Values)
+
+	// the values are scoped to the squadron i.e. within a workspace
+	_, set := os.LookupEnv("SQUADRON_TEST_TAG")
+	assert.False(t, set)
+	other := t.TempDir()
+	testutils.Must(t, ioutil.WriteFile(path.Join(other, ".env"), []byte("SQUADRON_TEST_TAG=2.0.0\nSQUADRON_TEST_HOST=other.com\n"), 0644))
+	sq = squadron.New(other, "", []string{path.Join("testdata", "config-env", "squadron.yaml")})
+	sq.AddEnvFiles(path.Join(other, ".env"))
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	assert.Equal(t, "2.0.0", sq.GetConfig().Units["frontend"].Values["tag"])
+	assert.Equal(t, "other.com", sq.GetConfig().Units["frontend"].Values["host"])
+
+	// existing variables are not overridden
+	defer os.Unsetenv("SQUADRON_TEST_TAG")
+	testutils.Must(t, os.Setenv("SQUADRON_TEST_TAG", "3.0.0"))
+	sq = squadron.New(cwd, "", []string{path.Join("testdata", "config-env", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	assert.Equal(t, "3.0.0", sq.GetConfig().Units["frontend"].Values["tag"])
+}
+
+func TestConfigMultipassSnapshot(t *testing.T) {
+	testConfigSnapshot(t,
+		[]string{
+			path.Join("testdata", "config-multipass", "squadron.yaml"),
+		},
+		path.Join("testdata", "config-multipass", "squadron.yaml.snapshot"),
+		true,
+	)
+}
+
+func TestConfigCycle(t *testing.T) {
+	var cwd string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+
+	sq := squadron.New(cwd, "", []string{path.Join("testdata", "config-cycle", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+
+	err := sq.RenderConfig()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cyclic references in: .global.bar, .global.foo")
+	}
+}
+
+func TestConfigContextSnapshot(t *testing.T) {
+	var cwd string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+
+	sq := squadron.New(cwd, "demo", []string{path.Join("testdata", "config-context", "squadron.yaml")})
+	sq.SetProfile("dev")
+	sq.SetVar("host", "mycompany.com")
+
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	testutils.MustCheckSnapshot(t, path.Join("testdata", "config-context", "squadron.yaml.snapshot"), sq.GetConfigYAML())
+}
+
+func TestConfigSetSnapshot(t *testing.T) {
+	var cwd string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+
+	sq := squadron.New(cwd, "", []string{
+		path.Join("testdata", "config-set", "squadron.yaml"),
+		path.Join("testdata", "config-set", "squadron.override.yaml"),
+	})
+
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	// --set overrides files, --set-string overrides --set and --set-file overrides --set-string
+	testutils.Must(t, sq.Override(
+		[]string{
+			"squadron.frontend.values.replicas=3,squadron.frontend.values.debug=true",
+			"squadron.frontend.values.image.tag=1.0.0",
+			"squadron.frontend.values.ingress.hosts[0].path=/foo",
+			`squadron.frontend.values.annotations.mycompany\.com/team=storefront`,
+			"squadron.frontend.values.config=none",
+		},
+		[]string{"squadron.frontend.values.image.tag=0123"},
+		[]string{"squadron.frontend.values.config=" + path.Join("testdata", "config-set", "config.json")},
+	), "failed to override config")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	testutils.MustCheckSnapshot(t, path.Join("testdata", "config-set", "squadron.yaml.snapshot"), sq.GetConfigYAML())
+}
+
+func TestConfigFormatsSnapshot(t *testing.T) {
+	testConfigSnapshot(t,
+		[]string{
+			path.Join("testdata", "config-formats", "squadron.yaml"),
+			path.Join("testdata", "config-formats", "squadron.override.json"),
+			path.Join("testdata", "config-formats", "squadron.override.toml"),
+		},
+		path.Join("testdata", "config-formats", "squadron.yaml.snapshot"),
+		true,
+	)
+}
+
 func TestConfigNoRenderSnapshot(t *testing.T) {
 	testConfigSnapshot(t,
 		[]string{
@@ -61,6 +196,687 @@ func TestConfigNoRenderSnapshot(t *testing.T) {
 	)
 }
 
+func TestConfigVolatileFunctions(t *testing.T) {
+	var cwd string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+
+	sq := squadron.New(cwd, "", []string{path.Join("testdata", "config-volatile", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	// random values keep their result across render passes
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+
+	values := sq.GetConfig().Units["app"].Values
+	assert.Len(t, values["password"], 8)
+	assert.Equal(t, values["password"].(string)+"-derived", values["derived"])
+	// while each call site gets its own value
+	assert.NotEqual(t, values["password"], values["again"])
+	assert.Len(t, values["id"], 36)
+}
+
+func TestGitTemplateFunction(t *testing.T) {
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=squadron", "GIT_AUTHOR_EMAIL=squadron@foomo.org",
+			"GIT_COMMITTER_NAME=squadron", "GIT_COMMITTER_EMAIL=squadron@foomo.org",
+			"GIT_COMMITTER_DATE=2021-01-02T03:04:05+00:00", "GIT_AUTHOR_DATE=2021-01-02T03:04:05+00:00",
+		)
+		out, err := cmd.CombinedOutput()
+		testutils.Must(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, content string) {
+		testutils.Must(t, os.MkdirAll(path.Dir(path.Join(dir, name)), 0755))
+		testutils.Must(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+	data, err := ioutil.ReadFile(path.Join("testdata", "config-git", "squadron.yaml"))
+	testutils.Must(t, err, "failed to read config")
+	write(path.Join("deploy", "squadron.yaml"), string(data))
+	write(path.Join("app", "Dockerfile"), "FROM scratch\n")
+	write(path.Join("chart", "Chart.yaml"), "name: app\n")
+
+	run("init", "-q")
+	run("checkout", "-q", "-b", "main")
+	run("remote", "add", "origin", "https://github.com/foomo/squadron.git")
+	run("add", "app")
+	run("commit", "-q", "-m", "app")
+	appSha := run("log", "-1", "--format=%h")
+	run("add", "chart")
+	run("commit", "-q", "-m", "chart")
+	write(path.Join("app", "main.go"), "package main\n")
+
+	render := func(file string) (*squadron.Squadron, error) {
+		sq := squadron.New(dir, "", []string{file})
+		testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+		return sq, sq.RenderConfig()
+	}
+
+	sq, err := render(path.Join(dir, "deploy", "squadron.yaml"))
+	testutils.Must(t, err, "failed to render config")
+	assert.Equal(t, map[string]interface{}{
+		"branch":     "main",
+		"tag":        "main",
+		"committime": "2021-01-02T03:04:05+00:00",
+		"shortsha":   appSha,
+		"dirty":      true,
+		"clean":      false,
+		"remoteurl":  "https://github.com/foomo/squadron.git",
+		"remote":     "https://github.com/foomo/squadron.git",
+	}, sq.GetConfig().Units["app"].Values)
+
+	// an exact tag takes precedence over the branch
+	run("tag", "v1.0.0")
+	sq, err = render(path.Join(dir, "deploy", "squadron.yaml"))
+	testutils.Must(t, err, "failed to render tagged config")
+	assert.Equal(t, "v1.0.0", sq.GetConfig().Units["app"].Values["tag"])
+
+	write("squadron.yaml", "version: \"2.0\"\nsquadron:\n  app:\n    values:\n      foo: <% git \"foo\" %>\n")
+	_, err = render(path.Join(dir, "squadron.yaml"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown git action "foo"`)
+	}
+}
+
+func TestSecretCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell to stub the op cli")
+	}
+	// stub the 1password cli to log its calls
+	bin, dir := t.TempDir(), t.TempDir()
+	log := path.Join(bin, "op.log")
+	testutils.Must(t, ioutil.WriteFile(path.Join(bin, "op"), []byte("#!/bin/sh\necho \"$3\" >> "+log+"\nprintf \"secret-$3\"\n"), 0755))
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer os.Unsetenv("OP_SESSION_acme")
+	testutils.Must(t, os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH")))
+	testutils.Must(t, os.Setenv("OP_SESSION_acme", "session"))
+	calls := func() []string {
+		data, err := ioutil.ReadFile(log)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		testutils.Must(t, err, "failed to read op log")
+		return strings.Fields(string(data))
+	}
+	render := func(ttl time.Duration, passphrase string) (*squadron.Squadron, error) {
+		sq := squadron.New(dir, "", []string{path.Join("testdata", "config-secret", "squadron.yaml")})
+		sq.SetSecretCache(ttl, passphrase)
+		testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+		return sq, sq.RenderConfig()
+	}
+
+	// op is called once per key across all render passes
+	sq, err := render(time.Hour, "passphrase")
+	testutils.Must(t, err, "failed to render config")
+	assert.Equal(t, []string{"uuid-1", "uuid-2"}, sorted(calls()))
+	values := sq.GetConfig().Units["app"].Values
+	assert.Equal(t, "secret-uuid-1", values["again"])
+	assert.Equal(t, "secret-uuid-1-derived", values["derived"])
+
+	// the secrets are loaded from the store
+	_, err = render(time.Hour, "passphrase")
+	testutils.Must(t, err, "failed to render cached config")
+	assert.Len(t, calls(), 2)
+
+	// a wrong passphrase fails to decrypt the store
+	_, err = render(time.Hour, "wrong")
+	assert.Error(t, err)
+
+	// expired secrets are fetched again
+	testutils.Must(t, os.Remove(path.Join(dir, ".squadron", "secrets.cache")))
+	_, err = render(time.Nanosecond, "passphrase")
+	testutils.Must(t, err, "failed to render config")
+	_, err = render(time.Nanosecond, "passphrase")
+	testutils.Must(t, err, "failed to render expired config")
+	assert.Len(t, calls(), 6)
+}
+
+func sorted(values []string) []string {
+	sort.Strings(values)
+	return values
+}
+
+func TestConfigTemplateError(t *testing.T) {
+	var cwd string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+
+	file := path.Join("testdata", "config-template-error", "squadron.yaml")
+	sq := squadron.New(cwd, "", []string{file})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+
+	err := sq.RenderConfig()
+	templateErr, ok := errors.Cause(err).(*squadron.TemplateError)
+	if !ok {
+		t.Fatalf("expected template error, got: %v", err)
+	}
+	assert.Equal(t, file, templateErr.File)
+	assert.Equal(t, 14, templateErr.Line)
+	assert.Equal(t, ".Global.port", templateErr.Expr)
+	assert.Contains(t, templateErr.Snippet, "> 14 |       port: <% .Global.port %>")
+	assert.Subset(t, templateErr.Vars, []string{".Global.host", ".Squadron.frontend", ".Unit.values", ".Namespace"})
+}
+
+func TestConfigTemplateErrorPosition(t *testing.T) {
+	var cwd string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+
+	templateError := func(sq *squadron.Squadron) *squadron.TemplateError {
+		err := sq.RenderConfig()
+		templateErr, ok := errors.Cause(err).(*squadron.TemplateError)
+		if !ok {
+			t.Fatalf("expected template error, got: %v", err)
+		}
+		return templateErr
+	}
+
+	// the same expression of another unit must not be reported
+	file := path.Join("testdata", "config-template-error", "squadron.units.yaml")
+	sq := squadron.New(cwd, "", []string{file})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	templateErr := templateError(sq)
+	assert.Equal(t, file, templateErr.File)
+	assert.Equal(t, 12, templateErr.Line)
+	assert.Contains(t, templateErr.Snippet, "> 12 |         scale: <% .Unit.values.replicas %>")
+
+	// values without a declaring file are reported within the merged config
+	sq = squadron.New(cwd, "", []string{path.Join("testdata", "config-template-error", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.Override([]string{"global.port=8080", "squadron.frontend.values.url=<% .Global.url %>"}, nil, nil))
+	templateErr = templateError(sq)
+	lines := strings.Split(sq.GetConfigYAML(), "\n")
+	line := 0
+	for i, l := range lines {
+		if strings.Contains(l, "<% .Global.url %>") {
+			line = i + 1
+		}
+	}
+	assert.Equal(t, "merged config", templateErr.File)
+	assert.Equal(t, line, templateErr.Line)
+	assert.Equal(t, ".Global.url", templateErr.Expr)
+}
+
+func TestConfigPaths(t *testing.T) {
+	var cwd, dir string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+	testutils.Must(t, util.ValidatePath(path.Join("testdata", "config-paths"), &dir))
+
+	sq := squadron.New(cwd, "", []string{
+		path.Join("testdata", "config-paths", "squadron.yaml"),
+		path.Join("testdata", "config-paths", "override", "squadron.override.yaml"),
+	})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+
+	unit := sq.GetConfig().Units["frontend"]
+	assert.Equal(t, "mychart", unit.Chart.Name)
+	assert.Equal(t, "file://"+path.Join(dir, "chart"), unit.Chart.Repository)
+	assert.Equal(t, path.Join(dir, "app"), unit.Builds["default"].Context)
+	assert.Equal(t, "Dockerfile", unit.Builds["default"].Dockerfile)
+	assert.Equal(t, path.Join(dir, "app"), unit.Builds["admin"].Context)
+	// values are not paths
+	assert.Equal(t, "${PWD}", unit.Values["dir"])
+	assert.Equal(t, "foo: bar", unit.Values["config"])
+	assert.Equal(t, "10m", unit.Helm.Timeout)
+	assert.True(t, unit.Helm.Atomic)
+	assert.Equal(t, []string{path.Join(dir, "chart", "values.prod.yaml")}, unit.Helm.ValuesFiles)
+	assert.Equal(t, path.Join(dir, "chart", "kustomize.sh"), unit.Helm.PostRenderer)
+
+	chart := sq.GetConfig().Chart
+	assert.Equal(t, "1.2.3", chart.AppVersion)
+	assert.Equal(t, "foomo", chart.Maintainers[0].Name)
+	assert.Equal(t, []string{path.Join(dir, "templates", "*.yaml")}, chart.Templates)
+}
+
+func TestConfigIncludes(t *testing.T) {
+	var cwd, dir string
+	testutils.Must(t, util.ValidatePath(".", &cwd))
+	testutils.Must(t, util.ValidatePath(path.Join("testdata", "config-includes", "shared"), &dir))
+
+	sq := squadron.New(cwd, "", []string{path.Join("testdata", "config-includes", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+
+	// paths of the included file are relative to its own directory
+	unit := sq.GetConfig().Units["frontend"]
+	assert.Equal(t, "file://"+path.Join(dir, "chart"), unit.Chart.Repository)
+	assert.Equal(t, path.Join(dir, "app"), unit.Builds["default"].Context)
+	assert.Equal(t, "foo: bar", unit.Values["config"])
+	assert.Equal(t, 2, unit.Values["replicas"])
+}
+
+func TestDiscover(t *testing.T) {
+	var dir string
+	testutils.Must(t, util.ValidatePath(path.Join("testdata", "discover"), &dir))
+
+	basePath, files, err := squadron.Discover(path.Join(dir, "app"), "dev")
+	testutils.Must(t, err, "failed to discover files")
+	assert.Equal(t, dir, basePath)
+	assert.Equal(t, []string{
+		path.Join(dir, "squadron.yaml"),
+		path.Join(dir, "squadron.dev.yaml"),
+		path.Join(dir, "squadron.override.yaml"),
+	}, files)
+
+	_, files, err = squadron.Discover(dir, "")
+	testutils.Must(t, err, "failed to discover files")
+	assert.Equal(t, []string{
+		path.Join(dir, "squadron.yaml"),
+		path.Join(dir, "squadron.override.yaml"),
+	}, files)
+}
+
+func TestWorkspace(t *testing.T) {
+	var dir string
+	testutils.Must(t, util.ValidatePath(path.Join("testdata", "workspace"), &dir))
+
+	ws, err := squadron.DiscoverWorkspace(path.Join(dir, "squadrons", "storefinder"))
+	testutils.Must(t, err, "failed to discover workspace")
+	dirs, err := ws.SquadronDirs()
+	testutils.Must(t, err, "failed to list squadrons")
+	assert.Equal(t, map[string]string{
+		"checkout":    path.Join(dir, "squadrons", "checkout"),
+		"storefinder": path.Join(dir, "squadrons", "storefinder"),
+	}, dirs)
+
+	sq := squadron.New(dirs["storefinder"], "", []string{path.Join(dirs["storefinder"], "squadron.yaml")})
+	sq.InheritGlobal(ws.Global)
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	testutils.MustCheckSnapshot(t, path.Join("testdata", "workspace", "squadron.yaml.snapshot"), sq.GetConfigYAML())
+}
+
+func TestUniteToggles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell to stub the helm cli")
+	}
+	log, deployed := stubHelm(t)
+
+	tests := []struct {
+		name     string
+		down     bool
+		selected []string
+		// deployed values of the release, empty if not installed
+		deployed string
+		// expected toggles of the generated chart, nil if the release is uninstalled
+		want  map[string]bool
+		calls []string
+	}{
+		{
+			name:     "full selection",
+			selected: []string{"backend", "frontend"},
+			want:     map[string]bool{"backend": true, "frontend": true},
+			calls:    []string{"dependency"},
+		},
+		{
+			name:     "partial selection keeps the deployed state",
+			selected: []string{"backend"},
+			deployed: `{"frontend": {"enabled": true}, "backend": {"enabled": false}}`,
+			want:     map[string]bool{"backend": true, "frontend": true},
+			calls:    []string{"get", "dependency"},
+		},
+		{
+			name:     "partial selection of a release without toggles",
+			selected: []string{"backend"},
+			deployed: `{"frontend": {"image": "frontend"}, "backend": {"image": "backend"}}`,
+			want:     map[string]bool{"backend": true, "frontend": true},
+			calls:    []string{"get", "dependency"},
+		},
+		{
+			name:     "partial selection without release",
+			selected: []string{"backend"},
+			want:     map[string]bool{"backend": true, "frontend": false},
+			calls:    []string{"get", "dependency"},
+		},
+		{
+			name:     "down keeps the other deployed units",
+			down:     true,
+			selected: []string{"backend"},
+			deployed: `{"frontend": {"enabled": true}, "backend": {"enabled": true}}`,
+			want:     map[string]bool{"backend": false, "frontend": true},
+			calls:    []string{"get", "dependency", "upgrade"},
+		},
+		{
+			name:     "down of the last enabled unit uninstalls the release",
+			down:     true,
+			selected: []string{"frontend"},
+			deployed: `{"frontend": {"enabled": true}, "backend": {"enabled": false}}`,
+			calls:    []string{"get", "uninstall"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.Remove(log)
+			_ = os.Remove(deployed)
+			if tt.deployed != "" {
+				testutils.Must(t, ioutil.WriteFile(deployed, []byte(tt.deployed), 0644))
+			}
+			dir := t.TempDir()
+			sq := squadron.New(dir, "default", []string{path.Join("testdata", "config-unite", "squadron.yaml")})
+			testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+			testutils.Must(t, sq.RenderConfig(), "failed to render config")
+			units := map[string]squadron.Unit{}
+			for _, name := range tt.selected {
+				units[name] = sq.GetConfig().Units[name]
+			}
+			if tt.down {
+				testutils.Must(t, sq.Down(units, nil), "failed to run down")
+			} else {
+				testutils.Must(t, sq.Generate(units), "failed to generate")
+			}
+			data, err := ioutil.ReadFile(log)
+			testutils.Must(t, err, "failed to read helm log")
+			assert.Equal(t, tt.calls, strings.Fields(string(data)))
+			if tt.want == nil {
+				return
+			}
+
+			chart, values := readChart(t, path.Join(dir, ".squadron", "shop"))
+			got := map[string]bool{}
+			for name, v := range values {
+				got[name], _ = v.(map[string]interface{})["enabled"].(bool)
+			}
+			assert.Equal(t, tt.want, got)
+
+			// the toggles are applied through the dependency conditions
+			conditions := map[string]string{}
+			for _, dependency := range chart.Dependencies {
+				conditions[dependency.Alias] = dependency.Condition
+			}
+			assert.Equal(t, map[string]string{"backend": "backend.enabled", "frontend": "frontend.enabled"}, conditions)
+		})
+	}
+}
+
+func TestGenerateChart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell to stub the helm cli")
+	}
+	stubHelm(t)
+
+	dir := t.TempDir()
+	sq := squadron.New(dir, "default", []string{path.Join("testdata", "config-chart", "squadron.yaml")})
+	sq.SetVar("appVersion", "1.2.3")
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	testutils.Must(t, sq.Generate(sq.GetConfig().Units), "failed to generate")
+
+	chartPath := path.Join(dir, ".squadron", "shop")
+	chart, values := readChart(t, chartPath)
+	assert.Equal(t, "shop", chart.Name)
+	assert.Equal(t, "Shop", chart.Description)
+	assert.Equal(t, "1.0.0", chart.Version)
+	assert.Equal(t, "1.2.3", chart.AppVersion)
+	assert.Equal(t, []squadron.ChartMaintainer{{Name: "foomo", Email: "foomo@example.com"}}, chart.Maintainers)
+	assert.Equal(t, map[string]string{"category": "e-commerce"}, chart.Annotations)
+	if assert.Len(t, chart.Dependencies, 2) {
+		assert.Equal(t, "backend", chart.Dependencies[0].Alias)
+		assert.Equal(t, "backend.enabled", chart.Dependencies[0].Condition)
+		assert.Equal(t, "frontend", chart.Dependencies[1].Alias)
+		assert.Equal(t, "frontend.enabled", chart.Dependencies[1].Condition)
+	}
+	assert.Equal(t, map[string]interface{}{"enabled": true}, values["frontend"])
+
+	templates, err := ioutil.ReadDir(path.Join(chartPath, "templates"))
+	testutils.Must(t, err, "failed to read templates")
+	var names []string
+	for _, template := range templates {
+		names = append(names, template.Name())
+	}
+	assert.Equal(t, []string{"configmap.yaml", "secret.yaml"}, names)
+	data, err := ioutil.ReadFile(path.Join(chartPath, "templates", "secret.yaml"))
+	testutils.Must(t, err, "failed to read template")
+	assert.Contains(t, string(data), "{{ .Release.Name }}-secret")
+
+	// an explicit version takes precedence over chart.version
+	archive, err := sq.Package("", "2.0.0")
+	testutils.Must(t, err, "failed to package")
+	assert.Equal(t, path.Join(dir, ".squadron", "shop-2.0.0.tgz"), archive)
+	chart, _ = readChart(t, chartPath)
+	assert.Equal(t, "2.0.0", chart.Version)
+
+	// templates of the same name would overwrite each other
+	sq = squadron.New(dir, "default", []string{path.Join("testdata", "config-chart", "squadron.duplicate.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	if err := sq.Generate(sq.GetConfig().Units); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "share the same name")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("testdata", "migrate", "squadron.yaml"))
+	testutils.Must(t, err, "failed to read file")
+
+	out, err := squadron.Migrate(data)
+	testutils.Must(t, err, "failed to migrate")
+	assert.Contains(t, string(out), "# Schema version")
+	testutils.MustCheckSnapshot(t, path.Join("testdata", "migrate", "squadron.yaml.snapshot"), string(out))
+
+	_, err = squadron.Migrate([]byte(`version: "99.0"`))
+	assert.Error(t, err)
+
+	// files without a version are considered to be up to date
+	unversioned := []byte("squadron:\n  frontend:\n    build:\n      image: <% env \"IMAGE\" %>\n")
+	unchanged, err := squadron.Migrate(unversioned)
+	testutils.Must(t, err, "failed to migrate")
+	assert.Equal(t, string(unversioned), string(unchanged))
+
+	// the migrated file renders the same as the original one being migrated at load time
+	defer os.Unsetenv("TAG")
+	defer os.Unsetenv("PORT")
+	testutils.Must(t, os.Setenv("TAG", "1.2.3"))
+	testutils.Must(t, os.Setenv("PORT", "80"))
+	dir := t.TempDir()
+	file := path.Join(dir, "squadron.yaml")
+	testutils.Must(t, ioutil.WriteFile(file, out, 0644))
+	for _, file := range []string{file, path.Join("testdata", "migrate", "squadron.yaml")} {
+		sq := squadron.New(dir, "", []string{file})
+		testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+		testutils.Must(t, sq.RenderConfig(), "failed to render config")
+		unit := sq.GetConfig().Units["frontend"]
+		assert.Equal(t, "1.2.3", unit.Builds["default"].Tag)
+		assert.Equal(t, "production:1.2.3", unit.Values["image"])
+		assert.Equal(t, "1.2.3", unit.Values["version"])
+		assert.Equal(t, "{{ .Release.Name }}.{{ .Values.domain }}", unit.Values["host"])
+		assert.Equal(t, []interface{}{80}, unit.Values["service"].(map[string]interface{})["ports"])
+	}
+}
+
+func TestScaffold(t *testing.T) {
+	units, err := squadron.DetectUnits(path.Join("testdata", "init"))
+	testutils.Must(t, err, "failed to detect units")
+	assert.Len(t, units, 3)
+
+	out, err := squadron.Scaffold("init", "docker.io/foomo", units)
+	testutils.Must(t, err, "failed to scaffold")
+	testutils.MustCheckSnapshot(t, path.Join("testdata", "init", "squadron.yaml.snapshot"), string(out))
+}
+
+func TestEditUnits(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("testdata", "edit", "squadron.yaml"))
+	testutils.Must(t, err, "failed to read file")
+
+	out, err := squadron.RemoveUnit(data, "legacy")
+	testutils.Must(t, err, "failed to remove unit")
+	out, err = squadron.AddUnit(out, squadron.UnitSpec{Name: "api", Chart: "./api/chart", Context: "./api"})
+	testutils.Must(t, err, "failed to add unit")
+	assert.Contains(t, string(out), "# the frontend")
+	assert.NotContains(t, string(out), "legacy")
+	testutils.MustCheckSnapshot(t, path.Join("testdata", "edit", "squadron.yaml.snapshot"), string(out))
+
+	_, err = squadron.AddUnit(out, squadron.UnitSpec{Name: "api"})
+	assert.Error(t, err)
+	_, err = squadron.RemoveUnit(out, "legacy")
+	assert.Error(t, err)
+}
+
+func TestUnitSelector(t *testing.T) {
+	sq := squadron.New("", "", []string{path.Join("testdata", "selector", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+
+	tests := []struct {
+		selector squadron.UnitSelector
+		expected []string
+	}{
+		{squadron.UnitSelector{Names: []string{"frontend-*"}}, []string{"frontend-admin", "frontend-app"}},
+		{squadron.UnitSelector{Names: []string{"!legacy"}}, []string{"backend", "frontend-admin", "frontend-app"}},
+		{squadron.UnitSelector{Tags: []string{"storefront"}, Names: []string{"!legacy"}}, []string{"backend", "frontend-app"}},
+		{squadron.UnitSelector{Tags: []string{"tier=backend"}}, []string{"backend", "legacy"}},
+		{squadron.UnitSelector{Tags: []string{"tier!=backend", "!admin"}}, []string{"frontend-app"}},
+		{squadron.UnitSelector{Tags: []string{"tier=*"}, Names: []string{"backend"}}, []string{"backend"}},
+	}
+	for _, test := range tests {
+		units, err := test.selector.Select(sq.GetConfig().Units)
+		testutils.Must(t, err, "failed to select units")
+		var names []string
+		for name := range units {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		assert.Equal(t, test.expected, names, "%+v", test.selector)
+	}
+
+	_, err := squadron.UnitSelector{Names: []string{"unknown"}}.Select(sq.GetConfig().Units)
+	assert.Error(t, err)
+}
+
+func TestUnitEnabled(t *testing.T) {
+	sq := squadron.New("", "", []string{path.Join("testdata", "config-enabled", "squadron.yaml")})
+	sq.SetProfile("prod")
+	sq.SetVar("legacy", "true")
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+
+	units := sq.GetConfig().Units
+	assert.True(t, units["frontend"].IsEnabled())
+	assert.False(t, units["backend"].IsEnabled())
+	assert.True(t, units["debug"].IsEnabled(), "templates are considered enabled until rendered")
+
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+	units = sq.GetConfig().Units
+	assert.True(t, units["frontend"].IsEnabled())
+	assert.False(t, units["backend"].IsEnabled())
+	assert.False(t, units["debug"].IsEnabled())
+	assert.True(t, units["legacy"].IsEnabled())
+	assert.Equal(t, "debug", units["debug"].Values["image"])
+}
+
+func TestUnitNamespace(t *testing.T) {
+	sq := squadron.New("", "demo", []string{path.Join("testdata", "config-namespace", "squadron.yaml")})
+	testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+	testutils.Must(t, sq.RenderConfig(), "failed to render config")
+
+	units := sq.GetConfig().Units
+	assert.Equal(t, "", units["frontend"].Namespace)
+	assert.Equal(t, "demo", units["frontend"].Values["namespace"])
+	assert.Equal(t, "demo-monitoring", units["monitoring"].Namespace)
+}
+
+func TestCheckKubeContext(t *testing.T) {
+	load := func(namespace string) *squadron.Squadron {
+		sq := squadron.New("", namespace, []string{path.Join("testdata", "kube-context", "squadron.yaml")})
+		testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+		return sq
+	}
+	units := load("").GetConfig().Units
+	frontend := map[string]squadron.Unit{"frontend": units["frontend"]}
+
+	assert.NoError(t, load("dev").CheckKubeContext("kind", "kind", frontend))
+	assert.NoError(t, load("stage-1").CheckKubeContext("shop", "gke-stage", frontend))
+	assert.NoError(t, load("dev").CheckKubeContext("gke_shop_europe-west1_prod", "", units))
+
+	err := load("dev").CheckKubeContext("kind", "kind", units)
+	if assert.Error(t, err) {
+		contextErr, ok := errors.Cause(err).(*squadron.KubeContextError)
+		if assert.True(t, ok) {
+			assert.Equal(t, "prod", contextErr.Namespace)
+			assert.Equal(t, []string{"gke_shop_europe-west1_prod"}, contextErr.Allowed)
+		}
+	}
+	assert.Error(t, load("stage-1").CheckKubeContext("kind", "kind", frontend))
+}
+
+func TestProtected(t *testing.T) {
+	load := func(namespace string, files ...string) *squadron.Squadron {
+		sq := squadron.New("", namespace, append([]string{path.Join("testdata", "protected", "squadron.yaml")}, files...))
+		testutils.Must(t, sq.MergeConfigFiles(), "failed to merge files")
+		return sq
+	}
+	units := load("").GetConfig().Units
+	frontend := map[string]squadron.Unit{"frontend": units["frontend"]}
+	backend := map[string]squadron.Unit{"frontend": units["frontend"], "backend": units["backend"]}
+
+	assert.False(t, load("dev").IsProtected(backend))
+	assert.True(t, load("dev", path.Join("testdata", "protected", "squadron.prod.yaml")).IsProtected(backend))
+	assert.True(t, load("prod").IsProtected(frontend))
+	assert.False(t, load("prod").RequiresConfirmation(frontend, false))
+	assert.True(t, load("prod").RequiresConfirmation(frontend, true))
+	assert.True(t, load("prod").RequiresConfirmation(backend, false))
+
+	releases := load("prod").Releases(units)
+	if assert.Len(t, releases, 3) {
+		assert.Equal(t, squadron.Release{Name: "shop-backend", Namespace: "prod", Units: []string{"backend"}}, releases[0])
+		assert.Equal(t, "prod-monitoring", releases[2].Namespace)
+	}
+}
+
+func TestPublishChart(t *testing.T) {
+	file := path.Join("testdata", "publish", "shop-1.0.0.tgz")
+	expected, err := ioutil.ReadFile(file)
+	testutils.Must(t, err, "failed to read file")
+
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/charts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		uploaded, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"saved":true}`))
+	}))
+	defer server.Close()
+
+	testutils.Must(t, squadron.PublishChart(file, server.URL), "failed to publish chart")
+	assert.Equal(t, expected, uploaded)
+
+	assert.Error(t, squadron.PublishChart(file, server.URL+"/unknown"))
+	assert.Error(t, squadron.PublishChart(file, "ftp://example.com"))
+}
+
+// stubHelm puts a helm script on the PATH which logs the commands and returns the deployed values if present
+func stubHelm(t *testing.T) (log, deployed string) {
+	t.Helper()
+	bin := t.TempDir()
+	log, deployed = path.Join(bin, "helm.log"), path.Join(bin, "deployed.json")
+	testutils.Must(t, ioutil.WriteFile(path.Join(bin, "helm"), []byte(`#!/bin/sh
+echo "$1" >> `+log+`
+if [ "$1 $2" = "get values" ]; then
+  [ -f `+deployed+` ] || { echo "Error: release: not found" >&2; exit 1; }
+  cat `+deployed+`
+fi
+`), 0755))
+	env := os.Getenv("PATH")
+	t.Cleanup(func() {
+		_ = os.Setenv("PATH", env)
+	})
+	testutils.Must(t, os.Setenv("PATH", bin+string(os.PathListSeparator)+env))
+	return log, deployed
+}
+
+// readChart returns the generated Chart.yaml and values.yaml
+func readChart(t *testing.T, chartPath string) (squadron.Chart, map[string]interface{}) {
+	t.Helper()
+	chart, values := squadron.Chart{}, map[string]interface{}{}
+	data, err := ioutil.ReadFile(path.Join(chartPath, "Chart.yaml"))
+	testutils.Must(t, err, "failed to read chart")
+	testutils.Must(t, yaml.Unmarshal(data, &chart))
+	data, err = ioutil.ReadFile(path.Join(chartPath, "values.yaml"))
+	testutils.Must(t, err, "failed to read values")
+	testutils.Must(t, yaml.Unmarshal(data, &values))
+	return chart, values
+}
+
 func testConfigSnapshot(t *testing.T, configs []string, snapshot string, render bool) {
 	var cwd string
 	testutils.Must(t, util.ValidatePath(".", &cwd))
@@ -4,15 +4,20 @@ import (
 	"bytes"
 	b64 "encoding/base64"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"reflect"
+	"sort"
 	"strings"
 	"text/template"
 
+	"github.com/Masterminds/sprig/v3"
 	"github.com/miracl/conflate"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 )
 
 func init() {
@@ -20,7 +25,12 @@ func init() {
 	conflate.Unmarshallers = conflate.UnmarshallerMap{
 		".yaml": {conflate.YAMLUnmarshal},
 		".yml":  {conflate.YAMLUnmarshal},
+		".json": {conflate.JSONUnmarshal},
+		".toml": {conflate.TOMLUnmarshal},
+		"":      {conflate.YAMLUnmarshal},
 	}
+	// includes are loaded by squadron so that their paths are resolved against their own directory
+	conflate.Includes = ""
 }
 
 type TemplateVars map[string]interface{}
@@ -29,15 +39,177 @@ func (tv *TemplateVars) add(name string, value interface{}) {
 	(*tv)[name] = value
 }
 
-func executeFileTemplate(text string, templateVars interface{}, errorOnMissing bool) ([]byte, error) {
-	templateFunctions := template.FuncMap{}
-	templateFunctions["env"] = env
-	templateFunctions["op"] = onePassword
+func newTemplateVars(config []byte) (TemplateVars, error) {
+	tv := TemplateVars{}
+	var vars map[string]interface{}
+	if err := yaml.Unmarshal(config, &vars); err != nil {
+		return nil, err
+	}
+	if value, ok := vars["global"]; ok {
+		tv.add("Global", replace(value))
+	}
+	if value, ok := vars["squadron"]; ok {
+		tv.add("Squadron", replace(value))
+		// keep the original unit names i.e. `index .Units "frontend-admin"`
+		tv.add("Units", value)
+	}
+	return tv, nil
+}
+
+type unitTemplate struct {
+	unit string
+	text string
+	// offset is the number of lines preceding the chunk
+	offset int
+}
+
+// splitUnitTemplates splits the marshaled config into chunks for each unit in the `squadron` section
+func splitUnitTemplates(text string) []unitTemplate {
+	var ret []unitTemplate
+	current := unitTemplate{}
+	var lines []string
+	inSquadron := false
+	flush := func(next string, offset int) {
+		current.text = strings.Join(lines, "\n")
+		ret = append(ret, current)
+		current = unitTemplate{unit: next, offset: offset}
+		lines = nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		switch {
+		case trimmed == "" || indent > 2:
+		case indent == 0:
+			if inSquadron {
+				flush("", i)
+			}
+			inSquadron = strings.HasPrefix(line, "squadron:")
+		case indent == 2 && inSquadron:
+			var key map[string]interface{}
+			if err := yaml.Unmarshal([]byte(trimmed), &key); err == nil && len(key) == 1 {
+				for name := range key {
+					if lines != nil {
+						flush(name, i)
+					} else {
+						current.unit = name
+					}
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	flush("", 0)
+	return ret
+}
+
+// templatePaths returns the paths of all values still containing template actions
+func templatePaths(config []byte) []string {
+	var vars interface{}
+	if err := yaml.Unmarshal(config, &vars); err != nil {
+		return nil
+	}
+	var ret []string
+	var walk func(prefix string, in interface{})
+	walk = func(prefix string, in interface{}) {
+		switch value := in.(type) {
+		case map[string]interface{}:
+			for k, v := range value {
+				walk(prefix+"."+k, v)
+			}
+		case []interface{}:
+			for i, v := range value {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), v)
+			}
+		case string:
+			if strings.Contains(value, "<%") {
+				ret = append(ret, prefix)
+			}
+		}
+	}
+	walk("", vars)
+	sort.Strings(ret)
+	return ret
+}
+
+// volatileFunctions are sprig functions returning a different result on each call, which would
+// prevent the render passes from converging
+var volatileFunctions = []string{
+	"randAlphaNum", "randAlpha", "randAscii", "randNumeric", "randBytes", "randInt", "uuidv4", "now", "ago", "shuffle",
+	"bcrypt", "htpasswd", "encryptAES", "genPrivateKey", "genCA", "genCAWithKey", "genSelfSignedCert",
+	"genSelfSignedCertWithKey", "genSignedCert", "genSignedCertWithKey",
+}
+
+// cachedFunction wraps the template function to return the cached result of the nth call with the same args
+func cachedFunction(c *cache, key string, fn interface{}, calls map[string]int) interface{} {
+	value := reflect.ValueOf(fn)
+	return reflect.MakeFunc(value.Type(), func(args []reflect.Value) []reflect.Value {
+		k := key
+		for _, arg := range args {
+			k += fmt.Sprintf(":%v", arg.Interface())
+		}
+		n := calls[k]
+		calls[k]++
+		ret, _ := c.get(fmt.Sprintf("%s#%d", k, n), func() (interface{}, error) {
+			return value.Call(args), nil
+		})
+		return ret.([]reflect.Value)
+	}).Interface()
+}
+
+func executeFileTemplate(text string, templateVars interface{}, errorOnMissing bool, c *cache, basePath string, vars map[string]string) ([]byte, error) {
+	// start with the sprig functions and override them with our own to keep existing semantics
+	templateFunctions := sprig.TxtFuncMap()
+	// calls are numbered per template so that each call site keeps its result across render passes
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(text))
+	scope, calls := fmt.Sprintf("%x", hash.Sum64()), map[string]int{}
+	for _, name := range volatileFunctions {
+		if fn, ok := templateFunctions[name]; ok {
+			templateFunctions[name] = cachedFunction(c, scope+":"+name, fn, calls)
+		}
+	}
+	templateFunctions["env"] = func(name string, def ...string) (string, error) {
+		return env(lookupEnv(vars, name), name, def...)
+	}
+	templateFunctions["requiredEnv"] = func(name, msg string) (string, error) {
+		return requiredEnv(lookupEnv(vars, name), msg)
+	}
+	templateFunctions["op"] = func(account, uuid, field string) (string, error) {
+		return c.secret(fmt.Sprintf("op:%s/%s/%s", account, uuid, field), func() (string, error) {
+			return onePassword(account, uuid, field)
+		})
+	}
 	templateFunctions["base64"] = base64
 	templateFunctions["default"] = defaultIndex
 	templateFunctions["indent"] = indent
-	templateFunctions["file"] = file
-	templateFunctions["git"] = git
+	templateFunctions["file"] = func(v string) (string, error) {
+		value, err := c.get("file:"+v, func() (interface{}, error) {
+			return file(resolveFile(basePath, v))
+		})
+		if err != nil {
+			return "", err
+		}
+		return value.(string), nil
+	}
+	templateFunctions["git"] = func(action string, dir ...string) (interface{}, error) {
+		return c.get("git:"+action+":"+strings.Join(dir, ":"), func() (interface{}, error) {
+			cwd := basePath
+			if len(dir) > 0 {
+				cwd = resolveFile(basePath, dir[0])
+			}
+			return git(action, cwd)
+		})
+	}
+	templateFunctions["toYaml"] = toYAML
+	templateFunctions["fromYaml"] = fromYAML
+	templateFunctions["required"] = func(msg string, v interface{}) (interface{}, error) {
+		// values might not be resolved yet on the initial execution
+		if !errorOnMissing {
+			return v, nil
+		}
+		return required(msg, v)
+	}
 
 	tpl, err := template.New("squadron").Delims("<%", "%>").Funcs(templateFunctions).Parse(text)
 	if err != nil {
@@ -53,14 +225,30 @@ func executeFileTemplate(text string, templateVars interface{}, errorOnMissing b
 	return out.Bytes(), nil
 }
 
-func env(name string) (string, error) {
-	value := os.Getenv(name)
-	if value == "" {
+// lookupEnv returns the env variable falling back to the values of the env files
+func lookupEnv(vars map[string]string, name string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return vars[name]
+}
+
+func env(value, name string, def ...string) (string, error) {
+	if value == "" && len(def) > 0 {
+		return def[0], nil
+	} else if value == "" {
 		return "", fmt.Errorf("env variable %q was empty", name)
 	}
 	return value, nil
 }
 
+func requiredEnv(value, msg string) (string, error) {
+	if value == "" {
+		return "", errors.New(msg)
+	}
+	return value, nil
+}
+
 func file(v string) (string, error) {
 	if v == "" {
 		return "", nil
@@ -83,34 +271,86 @@ func base64(v string) string {
 	return b64.StdEncoding.EncodeToString([]byte(v))
 }
 
-func replace(in interface{}) {
+func required(msg string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, errors.New(msg)
+	} else if value, ok := v.(string); ok && value == "" {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+func toYAML(v interface{}) (string, error) {
+	out := bytes.NewBuffer([]byte{})
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+func fromYAML(v string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(v), &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// replace returns a copy with all `-` in map keys replaced by `_` so they can be used as template fields
+func replace(in interface{}) interface{} {
 	if value, ok := in.(map[string]interface{}); ok {
+		ret := make(map[string]interface{}, len(value))
 		for k, v := range value {
-			if strings.Contains(k, "-") {
-				value[strings.ReplaceAll(k, "-", "_")] = v
-				delete(value, k)
-			}
-			replace(v)
+			ret[strings.ReplaceAll(k, "-", "_")] = replace(v)
 		}
+		return ret
 	}
+	return in
 }
 
-func git(action string) (string, error) {
-	cmd := exec.Command("git")
-
+// git returns information about the repository of the given directory i.e. a build context
+func git(action string, cwd string) (interface{}, error) {
 	switch action {
 	case "tag":
-		cmd.Args = append(cmd.Args, "describe", "--tags", "--always")
+		return gitOutput(cwd, "describe", "--tags", "--always")
 	case "commitsha":
-		cmd.Args = append(cmd.Args, "rev-list", "-1", "HEAD")
+		return gitOutput(cwd, "rev-list", "-1", "HEAD")
 	case "abbrevcommitsha":
-		cmd.Args = append(cmd.Args, "rev-list", "-1", "HEAD", "--abbrev-commit")
+		return gitOutput(cwd, "rev-list", "-1", "HEAD", "--abbrev-commit")
+	case "shortsha":
+		// last commit touching the directory
+		return gitOutput(cwd, "log", "-1", "--format=%h", "--", ".")
+	case "committime":
+		return gitOutput(cwd, "log", "-1", "--format=%cI")
+	case "branch":
+		return gitOutput(cwd, "rev-parse", "--abbrev-ref", "HEAD")
+	case "remoteurl", "remote url":
+		return gitOutput(cwd, "remote", "get-url", "origin")
+	case "dirty":
+		res, err := gitOutput(cwd, "status", "--porcelain", "--", ".")
+		if err != nil {
+			return nil, err
+		}
+		return res != "", nil
+	case "tag-or-branch":
+		if res, err := gitOutput(cwd, "describe", "--tags", "--exact-match"); err == nil {
+			return res, nil
+		}
+		return gitOutput(cwd, "rev-parse", "--abbrev-ref", "HEAD")
+	default:
+		return nil, fmt.Errorf("unknown git action %q", action)
 	}
+}
+
+func gitOutput(cwd string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = cwd
 	res, err := cmd.Output()
 	if err != nil {
 		return "", err
 	}
-
 	return string(bytes.TrimSpace(res)), nil
 }
 
@@ -0,0 +1,225 @@
+package squadron
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	templateErrorSnippetLines = 2
+	// templateErrorMergedFile is reported when the declaring file of an expression is unknown i.e. for `--set` values
+	templateErrorMergedFile = "merged config"
+)
+
+var (
+	templateErrorLocationRegex = regexp.MustCompile(`template: squadron:(\d+)(?::(\d+))?: `)
+	templateErrorExprRegex     = regexp.MustCompile(`executing "squadron" at <(.*?)>: `)
+	templateActionRegex        = regexp.MustCompile(`<%.*?%>`)
+)
+
+// TemplateError maps a template execution error back to the squadron file declaring the expression
+type TemplateError struct {
+	File    string
+	Line    int
+	Expr    string
+	Snippet string
+	Vars    []string
+	Err     error
+}
+
+func (e *TemplateError) Error() string {
+	msg := templateErrorLocationRegex.ReplaceAllString(e.Err.Error(), "")
+	msg = templateErrorExprRegex.ReplaceAllString(msg, "")
+	ret := fmt.Sprintf("%s:%d: %s", e.File, e.Line, msg)
+	if e.Expr != "" {
+		ret += fmt.Sprintf(" (at %s)", e.Expr)
+	}
+	if e.Snippet != "" {
+		ret += "\n\n" + e.Snippet
+	}
+	if len(e.Vars) > 0 {
+		ret += "\navailable variables: " + strings.Join(e.Vars, ", ")
+	}
+	return ret
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// newTemplateError maps the failing line of the rendered chunk to the squadron file declaring it
+func newTemplateError(err error, chunk unitTemplate, config string, sources sourceMap, tv TemplateVars) error {
+	match := templateErrorLocationRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(match[1])
+	col, _ := strconv.Atoi(match[2])
+	// report the line within the merged config unless the declaring file is known
+	line += chunk.offset
+	ret := &TemplateError{
+		File: templateErrorMergedFile,
+		Line: line,
+		Vars: templateVarNames(tv),
+		Err:  err,
+	}
+	if m := templateErrorExprRegex.FindStringSubmatch(err.Error()); m != nil {
+		ret.Expr = m[1]
+	}
+
+	lines := strings.Split(config, "\n")
+	if line < 1 || line > len(lines) {
+		return ret
+	}
+	ret.Snippet = templateErrorSnippet(lines, line)
+
+	pos, ok := sources.locate(config, line)
+	if !ok {
+		return ret
+	}
+	data, readErr := ioutil.ReadFile(pos.file)
+	if readErr != nil {
+		return ret
+	}
+	fileLines := strings.Split(string(data), "\n")
+	// multi-line values keep their offset unless the file formats them differently
+	if action := templateErrorAction(lines[line-1], col, ret.Expr); pos.offset > 0 &&
+		(pos.line+pos.offset > len(fileLines) || (action != "" && !strings.Contains(fileLines[pos.line+pos.offset-1], action))) {
+		pos.offset = 0
+	}
+	if pos.line+pos.offset > len(fileLines) {
+		return ret
+	}
+	ret.File = pos.file
+	ret.Line = pos.line + pos.offset
+	ret.Snippet = templateErrorSnippet(fileLines, ret.Line)
+	return ret
+}
+
+// templateErrorAction returns the template action on the line matching the expression or column
+func templateErrorAction(line string, col int, expr string) string {
+	locs := templateActionRegex.FindAllStringIndex(line, -1)
+	if len(locs) == 0 {
+		return ""
+	}
+	for _, loc := range locs {
+		if expr != "" && strings.Contains(line[loc[0]:loc[1]], expr) {
+			return line[loc[0]:loc[1]]
+		}
+	}
+	for _, loc := range locs {
+		if col > loc[0] && col <= loc[1] {
+			return line[loc[0]:loc[1]]
+		}
+	}
+	return line[locs[0][0]:locs[0][1]]
+}
+
+func templateErrorSnippet(lines []string, line int) string {
+	var ret []string
+	from, to := line-templateErrorSnippetLines, line+templateErrorSnippetLines
+	if from < 1 {
+		from = 1
+	}
+	if to > len(lines) {
+		to = len(lines)
+	}
+	width := len(strconv.Itoa(to))
+	for i := from; i <= to; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		ret = append(ret, fmt.Sprintf("%s %*d | %s", marker, width, i, lines[i-1]))
+	}
+	return strings.Join(ret, "\n")
+}
+
+func templateVarNames(tv TemplateVars) []string {
+	var ret []string
+	for name, value := range tv {
+		if m, ok := value.(map[string]interface{}); ok && len(m) > 0 {
+			for key := range m {
+				ret = append(ret, fmt.Sprintf(".%s.%s", name, key))
+			}
+		} else {
+			ret = append(ret, "."+name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sourcePosition is the location of a config key within a squadron file
+type sourcePosition struct {
+	file string
+	line int
+	// offset is the line within a multi-line value
+	offset int
+}
+
+// sourceMap maps config key paths i.e. `squadron.frontend.values.port` to the file declaring them
+type sourceMap map[string]sourcePosition
+
+// add records the key positions of the file, overriding the ones of earlier files
+func (m sourceMap) add(file string, data []byte) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return
+	}
+	walkYAMLKeys(&doc, "", func(path string, key *yaml.Node) {
+		m[path] = sourcePosition{file: file, line: key.Line}
+	})
+}
+
+// locate returns the declaring position of the given line of the merged config
+func (m sourceMap) locate(config string, line int) (sourcePosition, bool) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(config), &doc); err != nil {
+		return sourcePosition{}, false
+	}
+	var found string
+	var foundLine int
+	walkYAMLKeys(&doc, "", func(path string, key *yaml.Node) {
+		if key.Line <= line && key.Line >= foundLine {
+			found, foundLine = path, key.Line
+		}
+	})
+	pos, ok := m[found]
+	if !ok {
+		return pos, false
+	}
+	pos.offset = line - foundLine
+	return pos, true
+}
+
+// walkYAMLKeys calls fn with the path and node of every mapping key and sequence item
+func walkYAMLKeys(node *yaml.Node, prefix string, fn func(path string, key *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkYAMLKeys(child, prefix, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			path := node.Content[i].Value
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			fn(path, node.Content[i])
+			walkYAMLKeys(node.Content[i+1], path, fn)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			path := fmt.Sprintf("%s[%d]", prefix, i)
+			fn(path, child)
+			walkYAMLKeys(child, path, fn)
+		}
+	}
+}
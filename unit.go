@@ -1,17 +1,133 @@
 package squadron
 
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
 type Unit struct {
-	Chart  ChartDependency        `yaml:"chart,omitempty"`
-	Builds map[string]Build       `yaml:"builds,omitempty"`
-	Values map[string]interface{} `yaml:"values,omitempty"`
+	// Enabled defaults to true and may be a template
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// Namespace overrides the squadron's namespace for the unit's release
+	Namespace string                 `yaml:"namespace,omitempty"`
+	Chart     ChartDependency        `yaml:"chart,omitempty"`
+	Tags      []string               `yaml:"tags,omitempty"`
+	Builds    map[string]Build       `yaml:"builds,omitempty"`
+	Values    map[string]interface{} `yaml:"values,omitempty"`
+	// Helm options are applied to the unit's release only
+	Helm HelmOptions `yaml:"helm,omitempty"`
+}
+
+type HelmOptions struct {
+	Timeout      string   `yaml:"timeout,omitempty"`
+	Wait         bool     `yaml:"wait,omitempty"`
+	Atomic       bool     `yaml:"atomic,omitempty"`
+	Force        bool     `yaml:"force,omitempty"`
+	SkipCRDs     bool     `yaml:"skip_crds,omitempty"`
+	PostRenderer string   `yaml:"post_renderer,omitempty"`
+	Args         []string `yaml:"args,omitempty"`
+	// ValuesFiles are passed before the generated values which take precedence
+	ValuesFiles []string `yaml:"values_files,omitempty"`
+}
+
+// empty returns true if no options are set
+func (o HelmOptions) empty() bool {
+	return o.Timeout == "" && !o.Wait && !o.Atomic && !o.Force && !o.SkipCRDs && o.PostRenderer == "" &&
+		len(o.Args) == 0 && len(o.ValuesFiles) == 0
+}
+
+// valuesArgs returns the args for the values files
+func (o HelmOptions) valuesArgs() []string {
+	var ret []string
+	for _, file := range o.ValuesFiles {
+		ret = append(ret, "-f", file)
+	}
+	return ret
+}
+
+// renderArgs returns the args shared by helm upgrade and template
+func (o HelmOptions) renderArgs() []string {
+	var ret []string
+	if o.SkipCRDs {
+		ret = append(ret, "--skip-crds")
+	}
+	if o.PostRenderer != "" {
+		ret = append(ret, "--post-renderer", o.PostRenderer)
+	}
+	return ret
+}
+
+// upgradeArgs returns the args for helm upgrade
+func (o HelmOptions) upgradeArgs() []string {
+	ret := o.renderArgs()
+	if o.Timeout != "" {
+		ret = append(ret, "--timeout", o.Timeout)
+	}
+	if o.Wait {
+		ret = append(ret, "--wait")
+	}
+	if o.Atomic {
+		ret = append(ret, "--atomic")
+	}
+	if o.Force {
+		ret = append(ret, "--force")
+	}
+	return append(ret, o.Args...)
+}
+
+// uninstallArgs returns the args for helm uninstall
+func (o HelmOptions) uninstallArgs() []string {
+	var ret []string
+	if o.Timeout != "" {
+		ret = append(ret, "--timeout", o.Timeout)
+	}
+	return ret
+}
+
+func (u *Unit) UnmarshalYAML(value *yaml.Node) error {
+	type wrapper Unit
+	if key, enabled := mappingEntry(value, "enabled"); enabled != nil && enabled.Tag == "!!str" {
+		// rendered templates might be quoted
+		if v, err := strconv.ParseBool(strings.TrimSpace(enabled.Value)); err == nil {
+			u.Enabled = &v
+		} else if !strings.Contains(enabled.Value, "<%") {
+			return errors.Errorf("invalid enabled value %q", enabled.Value)
+		}
+		// skip the value to be decoded
+		node := copyNode(value)
+		node.Content = nil
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if value.Content[i] != key {
+				node.Content = append(node.Content, value.Content[i], value.Content[i+1])
+			}
+		}
+		parsed := u.Enabled
+		if err := node.Decode((*wrapper)(u)); err != nil {
+			return err
+		}
+		u.Enabled = parsed
+		return nil
+	}
+	return value.Decode((*wrapper)(u))
 }
 
 // ------------------------------------------------------------------------------------------------
 // ~ Public methods
 // ------------------------------------------------------------------------------------------------
 
+// IsEnabled returns false if the unit has been disabled
+func (u Unit) IsEnabled() bool {
+	return u.Enabled == nil || *u.Enabled
+}
+
 // Build ...
 func (u *Unit) Build() error {
+	if !u.IsEnabled() {
+		return nil
+	}
 	for _, build := range u.Builds {
 		if err := build.Build(); err != nil {
 			return err
@@ -22,6 +138,9 @@ func (u *Unit) Build() error {
 
 // Push ...
 func (u *Unit) Push() error {
+	if !u.IsEnabled() {
+		return nil
+	}
 	for _, build := range u.Builds {
 		if err := build.Push(); err != nil {
 			return err
@@ -12,6 +12,14 @@ func (c HelmCmd) UpdateDependency(chart, chartPath string) (string, error) {
 	return c.Base().Args("dependency", "update", chartPath).Run()
 }
 
-func (c HelmCmd) Package(chart, chartPath, destPath string) (string, error) {
-	return c.Base().Args("package", chartPath, "--destination", destPath).Run()
+func (c HelmCmd) Package(chart, chartPath, destPath, version string) (string, error) {
+	return c.Base().Args("package", chartPath, "--destination", destPath).Arg("--version", version).Run()
+}
+
+func (c HelmCmd) Push(chartFile, remote string) (string, error) {
+	return c.Base().Args("push", chartFile, remote).Run()
+}
+
+func (c HelmCmd) Create(chartPath string) (string, error) {
+	return c.Base().Args("create", chartPath).Run()
 }
@@ -104,6 +104,10 @@ func (c KubeCmd) GetNamespaces() ([]string, error) {
 	return parseResources(out, "namespace/")
 }
 
+func (c KubeCmd) CreateNamespace(namespace string) (string, error) {
+	return c.Args("create", "namespace", namespace).Run()
+}
+
 func (c KubeCmd) GetDeployments() ([]string, error) {
 	out, err := c.Args("get", "deployment", "-o", "name").Run()
 	if err != nil {
@@ -197,3 +201,13 @@ func parseResources(out, prefix string) ([]string, error) {
 	}
 	return res, nil
 }
+
+func (c KubeCmd) CurrentContext() (string, error) {
+	out, err := c.Args("config", "current-context").Run()
+	return strings.TrimSpace(out), err
+}
+
+func (c KubeCmd) ContextCluster(context string) (string, error) {
+	out, err := c.Args("config", "view", "-o", fmt.Sprintf(`jsonpath={.contexts[?(@.name=="%s")].context.cluster}`, context)).Run()
+	return strings.TrimSpace(out), err
+}
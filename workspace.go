@@ -0,0 +1,86 @@
+package squadron
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const workspaceFile = "squadron-workspace.yaml"
+
+// Workspace manages multiple squadrons within one repository
+type Workspace struct {
+	Version string `yaml:"version,omitempty"`
+	// Squadrons lists the squadron directories relative to the workspace file, globs are supported
+	Squadrons []string `yaml:"squadrons,omitempty"`
+	// Global values are inherited by each squadron
+	Global   map[string]interface{} `yaml:"global,omitempty"`
+	basePath string
+}
+
+// DiscoverWorkspace walks up from dir to the nearest squadron-workspace.yaml
+func DiscoverWorkspace(dir string) (*Workspace, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for !fileExists(filepath.Join(dir, workspaceFile)) {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.Errorf("could not find %s in any parent directory", workspaceFile)
+		}
+		dir = parent
+	}
+	return LoadWorkspace(filepath.Join(dir, workspaceFile))
+}
+
+// LoadWorkspace reads the given workspace file
+func LoadWorkspace(file string) (*Workspace, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read workspace file")
+	}
+	w := &Workspace{}
+	if err := yaml.Unmarshal(data, w); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal workspace file")
+	} else if err := validateVersion(w.Version); err != nil {
+		return nil, errors.Wrap(err, "invalid workspace file")
+	}
+	if w.basePath, err = filepath.Abs(filepath.Dir(file)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Workspace) BasePath() string {
+	return w.basePath
+}
+
+// SquadronDirs returns the directories of all squadrons in the workspace by name
+func (w *Workspace) SquadronDirs() (map[string]string, error) {
+	ret := map[string]string{}
+	for _, pattern := range w.Squadrons {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(w.basePath, pattern)
+		}
+		dirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid squadron pattern %q", pattern)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			if !fileExists(filepath.Join(dir, configFile)) {
+				continue
+			}
+			name := filepath.Base(dir)
+			if existing, ok := ret[name]; ok && existing != dir {
+				return nil, errors.Errorf("duplicate squadron name %q in %q and %q", name, existing, dir)
+			}
+			ret[name] = dir
+		}
+	}
+	return ret, nil
+}